@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// ScrapeBlocking collects blocked sessions, the depth of the blocking tree and
+// the blockers from v$session, and running long operations from v$session_longops.
+func (e *Exporter) ScrapeBlocking() {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, conn := range config.Cfgs {
+		if conn.db != nil {
+			var count, wait float64
+			err = conn.db.QueryRow(`SELECT count(*), nvl(max(seconds_in_wait),0)
+                                FROM v$session
+                                WHERE blocking_session IS NOT NULL`).Scan(&count, &wait)
+			if err != nil {
+				continue
+			}
+			e.blocked.WithLabelValues(conn.Database, conn.Instance).Set(count)
+			e.blockedWait.WithLabelValues(conn.Database, conn.Instance).Set(wait)
+
+			// Root blockers are not blocked themselves, a single blocker has depth 1.
+			var depth float64
+			err = conn.db.QueryRow(`SELECT nvl(max(level),1) - 1
+                                FROM v$session
+                                START WITH blocking_session IS NULL
+                                       AND sid IN (SELECT blocking_session FROM v$session)
+                                CONNECT BY NOCYCLE PRIOR sid = blocking_session`).Scan(&depth)
+			if err == nil {
+				e.blockingDepth.WithLabelValues(conn.Database, conn.Instance).Set(depth)
+			}
+
+			if *pBlockers {
+				// An idle blocker has no current statement, its previous one
+				// usually started the transaction holding the lock.
+				rows, err = conn.db.Query(`SELECT username, program, sql_id, blocked
+                                 FROM (SELECT b.username, b.program, nvl(b.sql_id,b.prev_sql_id) sql_id, count(*) blocked
+                                       FROM v$session w, v$session b
+                                       WHERE w.blocking_session = b.sid
+                                       AND w.blocking_instance = sys_context('USERENV','INSTANCE')
+                                       GROUP BY b.username, b.program, nvl(b.sql_id,b.prev_sql_id)
+                                       ORDER BY count(*) DESC)
+                                 WHERE rownum <= :1`, *pBlockingTop)
+				if err == nil {
+					for rows.Next() {
+						var user, program, sqlid sql.NullString
+						var value float64
+						if err := rows.Scan(&user, &program, &sqlid, &value); err != nil {
+							break
+						}
+						e.blocking.WithLabelValues(conn.Database, conn.Instance, user.String, program.String, sqlid.String).Set(value)
+					}
+					rows.Close()
+				}
+			}
+
+			e.longops.WithLabelValues(conn.Database, conn.Instance).Set(0)
+			rows, err = conn.db.Query(`SELECT sid, opname, sql_id, progress, time_remaining, running
+                                 FROM (SELECT sid, opname, sql_id, sofar/totalwork progress, nvl(time_remaining,0) time_remaining,
+                                              count(*) over () running
+                                       FROM v$session_longops
+                                       WHERE totalwork > 0 AND sofar < totalwork
+                                       ORDER BY elapsed_seconds DESC)
+                                 WHERE rownum <= :1`, *pBlockingTop)
+			if err == nil {
+				for rows.Next() {
+					var sid string
+					var opname string
+					var sqlid sql.NullString
+					var progress, remaining, running float64
+					if err := rows.Scan(&sid, &opname, &sqlid, &progress, &remaining, &running); err != nil {
+						break
+					}
+					e.longops.WithLabelValues(conn.Database, conn.Instance).Set(running)
+					e.longopsProgress.WithLabelValues(conn.Database, conn.Instance, sid, opname, sqlid.String).Set(progress)
+					e.longopsRemaining.WithLabelValues(conn.Database, conn.Instance, sid, opname, sqlid.String).Set(remaining)
+				}
+				rows.Close()
+			}
+		}
+	}
+}
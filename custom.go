@@ -0,0 +1,597 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// queryResult holds the rows returned by a custom query. It is kept between
+// scrapes so queries with an interval don't hit the database every time.
+// exported is set once the rows were exported.
+type queryResult struct {
+	cols     []string
+	rows     [][]interface{}
+	time     time.Time
+	exported bool
+}
+
+// appliesTo reports whether the query should run against the given connection.
+func (q *Query) appliesTo(conn *Config) bool {
+	switch q.Requires {
+	case "started":
+	case "open":
+		if !conn.ready(stateOpen) {
+			return false
+		}
+	default:
+		if !conn.ready(stateMounted) {
+			return false
+		}
+	}
+	if len(q.Instances.Include) > 0 && !matchInstance(q.Instances.Include, conn) {
+		return false
+	}
+	if matchInstance(q.Instances.Exclude, conn) {
+		return false
+	}
+	if len(q.DatabaseRole) > 0 && !strings.EqualFold(q.DatabaseRole, conn.role) {
+		return false
+	}
+	if len(q.MinVersion) > 0 && compareVersion(conn.version, q.MinVersion) < 0 {
+		return false
+	}
+	if len(q.MaxVersion) > 0 && compareVersion(conn.version, q.MaxVersion) > 0 {
+		return false
+	}
+	return true
+}
+
+// matchInstance checks if the instance or database name of conn is in the list.
+func matchInstance(list []string, conn *Config) bool {
+	for _, name := range list {
+		if strings.EqualFold(name, conn.Instance) || strings.EqualFold(name, conn.Database) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	bindRe    = regexp.MustCompile(`:([A-Za-z][A-Za-z0-9_$#]*)`)
+	literalRe = regexp.MustCompile(`'[^']*'`)
+)
+
+// bindArgs returns the named bind variables used in the SQL of a query.
+// Values come from the vars of the connection and the built-in variables,
+// names that are neither are left to Oracle.
+func bindArgs(conn *Config, query *Query, lastRun time.Time) []interface{} {
+	vars := map[string]interface{}{
+		"last_scrape": lastRun,
+		"database":    conn.Database,
+		"instance":    conn.Instance,
+	}
+	for name, v := range conn.Vars {
+		vars[strings.ToLower(name)] = v
+	}
+	var args []interface{}
+	seen := make(map[string]bool)
+	for _, m := range bindRe.FindAllStringSubmatch(literalRe.ReplaceAllString(query.Sql, "''"), -1) {
+		name := strings.ToLower(m[1])
+		if v, ok := vars[name]; ok && !seen[name] {
+			args = append(args, sql.Named(m[1], v))
+			seen[name] = true
+		}
+	}
+	return args
+}
+
+// runQuery executes a custom query and reads the whole result set.
+func runQuery(db queryer, query *Query, args ...interface{}) (*queryResult, error) {
+	ctx := context.Background()
+	if query.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, query.Timeout)
+		defer cancel()
+	}
+	rows, err := db.QueryContext(ctx, query.Sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := &queryResult{cols: cols, time: time.Now()}
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		for i := range cols {
+			vals[i] = &vals[i]
+		}
+		if err := rows.Scan(vals...); err != nil {
+			return nil, err
+		}
+		res.rows = append(res.rows, vals)
+	}
+	return res, rows.Err()
+}
+
+// customResult returns the rows of a query, either cached or freshly queried.
+func (e *Exporter) customResult(db queryer, conn *Config, pdb container, query *Query) (*queryResult, error) {
+	key := conn.Database + "/" + conn.Instance + "/" + pdb.name + "/" + query.Name
+	if res, ok := e.results[key]; ok && query.Interval > 0 && time.Since(res.time) < query.Interval {
+		return res, nil
+	}
+	lastRun, ok := e.lastRun[key]
+	if !ok {
+		lastRun = e.started
+	}
+	res, err := runQuery(db, query, bindArgs(conn, query, lastRun)...)
+	if err != nil {
+		return nil, err
+	}
+	e.lastRun[key] = res.time
+	if query.Interval > 0 {
+		e.results[key] = res
+	}
+	return res, nil
+}
+
+// ScrapeCustomQueries collects metrics from self defined queries from configuration file.
+func (e *Exporter) ScrapeCustomQueries() {
+	for c := range config.Cfgs {
+		conn := &config.Cfgs[c]
+		if conn.db == nil {
+			continue
+		}
+		forEachContainer(conn, func(db queryer, pdb container) {
+			for q := range conn.Queries {
+				query := &conn.Queries[q]
+				if !query.appliesTo(conn) || !query.runsIn(pdb) {
+					continue
+				}
+				res, err := e.customResult(db, conn, pdb, query)
+				if err != nil {
+					log.Errorln("Error running query", query.Name, "on", conn.Instance, pdb.name+":", err)
+					e.scrapeErrors.WithLabelValues("custom_" + query.Name).Inc()
+					continue
+				}
+				if err := e.exportCustom(conn, pdb, query, res); err != nil {
+					log.Errorln("Error exporting query", query.Name, "on", conn.Instance, pdb.name+":", err)
+					e.scrapeErrors.WithLabelValues("custom_" + query.Name).Inc()
+				}
+			}
+		})
+	}
+}
+
+// runsIn checks the container setting of a query: root, pdbs or all (default).
+func (q *Query) runsIn(pdb container) bool {
+	switch strings.ToLower(q.Container) {
+	case "root":
+		return len(pdb.conID) == 0 || pdb.conID == "1"
+	case "pdbs":
+		return len(pdb.conID) == 0 || pdb.conID != "1"
+	}
+	return true
+}
+
+// customMetric is a metric family built from one or more columns of a custom query.
+type customMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	histogram bool
+	labels    []string
+	query     string
+}
+
+// column returns the export settings of a metric column.
+func (q *Query) column(metric string) Column {
+	for name, col := range q.Columns {
+		if cleanName(name) == cleanName(metric) {
+			return col
+		}
+	}
+	return Column{}
+}
+
+// metrics returns the metric columns of the query. A key/value query has
+// only its value column.
+func (q *Query) metrics() []string {
+	if len(q.KeyColumn) > 0 {
+		if len(q.ValueColumn) > 0 {
+			return []string{q.ValueColumn}
+		}
+		return []string{"value"}
+	}
+	return q.Metrics
+}
+
+// labels returns the label columns of the query including the key column.
+func (q *Query) labels() []string {
+	if len(q.KeyColumn) > 0 {
+		return append(append([]string{}, q.Labels...), q.KeyColumn)
+	}
+	return q.Labels
+}
+
+// ownFamily reports whether a metric column is exported in its own metric
+// family instead of being a "metric" label of the query's family.
+func (q *Query) ownFamily(metric string) bool {
+	c := q.column(metric)
+	return len(q.KeyColumn) > 0 || q.PerColumn || (len(c.Type) > 0 && c.Type != "gauge") || len(c.Unit) > 0
+}
+
+// keyMatches checks the key of a key/value row against include_keys and exclude_keys.
+func (q *Query) keyMatches(key string) bool {
+	if q.includeKeys != nil && !q.includeKeys.MatchString(key) {
+		return false
+	}
+	if q.excludeKeys != nil && q.excludeKeys.MatchString(key) {
+		return false
+	}
+	return true
+}
+
+// metricName returns the name of the family a metric column is exported in.
+func (q *Query) metricName(metric string) string {
+	ns := config.Namespace
+	if len(ns) == 0 {
+		ns = namespace
+	}
+	prefix := q.Prefix
+	if len(prefix) == 0 {
+		prefix = strings.TrimSuffix(config.Prefix, "_")
+		if len(prefix) == 0 {
+			prefix = "custom"
+		}
+		prefix += "_" + q.Name
+	}
+	name := ns + "_" + cleanName(prefix)
+	if !q.ownFamily(metric) {
+		return name
+	}
+	col := q.column(metric)
+	if len(q.KeyColumn) == 0 {
+		name += "_" + cleanName(metric)
+	}
+	if len(col.Unit) > 0 && !strings.HasSuffix(name, "_"+col.Unit) {
+		name += "_" + col.Unit
+	}
+	if col.Type == "counter" && !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	return name
+}
+
+// addCustomMetrics creates the metric families of a custom query.
+func (e *Exporter) addCustomMetrics(query *Query) {
+	var err error
+	if len(query.IncludeKeys) > 0 {
+		if query.includeKeys, err = regexp.Compile(query.IncludeKeys); err != nil {
+			log.Fatalf("error: include_keys of query %s: %v", query.Name, err)
+		}
+	}
+	if len(query.ExcludeKeys) > 0 {
+		if query.excludeKeys, err = regexp.Compile(query.ExcludeKeys); err != nil {
+			log.Fatalf("error: exclude_keys of query %s: %v", query.Name, err)
+		}
+	}
+
+	switch strings.ToLower(query.NullValue) {
+	case "", "skip", "nan":
+	default:
+		if _, err := strconv.ParseFloat(query.NullValue, 64); err != nil {
+			log.Fatalf("error: null_value of query %s must be skip, nan or a number", query.Name)
+		}
+	}
+
+	for name, col := range query.Columns {
+		col.Type = strings.ToLower(col.Type)
+		switch col.Type {
+		case "", "gauge", "counter", "histogram":
+		default:
+			log.Fatalf("error: type of column %s in query %s must be gauge, counter or histogram", name, query.Name)
+		}
+		query.Columns[name] = col
+	}
+
+	query.Requires = strings.ToLower(query.Requires)
+	switch query.Requires {
+	case "", "open", "mounted", "started":
+	default:
+		log.Fatalf("error: requires of query %s must be open, mounted or started", query.Name)
+	}
+
+	query.Duplicates = strings.ToLower(query.Duplicates)
+	switch query.Duplicates {
+	case "", "last", "sum", "max", "error", "rownum":
+	default:
+		log.Fatalf("error: duplicates of query %s must be last, sum, max, error or rownum", query.Name)
+	}
+
+	labels := []string{}
+	for _, label := range query.labels() {
+		labels = append(labels, cleanName(label))
+	}
+	for _, metric := range query.metrics() {
+		name := query.metricName(metric)
+		col := query.column(metric)
+		m := &customMetric{valueType: prometheus.GaugeValue, query: query.Name}
+		switch col.Type {
+		case "", "gauge":
+		case "counter":
+			m.valueType = prometheus.CounterValue
+		case "histogram":
+			m.histogram = true
+		}
+		help := query.Help
+		variable := append([]string{}, labels...)
+		if query.ownFamily(metric) {
+			if len(col.Help) > 0 {
+				help = col.Help
+			}
+		} else {
+			variable = append(variable, "metric")
+		}
+		variable = append(variable, "database", "dbinstance")
+		variable = append(variable, pdbLabels()...)
+		if query.Duplicates == "rownum" {
+			variable = append(variable, "rownum")
+		}
+		m.labels = variable
+		// The same metric may come from several connections or queries,
+		// but only with the same labels and type.
+		if prev, ok := e.custom[name]; ok {
+			if prev.valueType != m.valueType || prev.histogram != m.histogram ||
+				strings.Join(prev.labels, ",") != strings.Join(m.labels, ",") {
+				log.Fatalf("error: metric %s of query %s conflicts with query %s (labels %v and %v)",
+					name, query.Name, prev.query, m.labels, prev.labels)
+			}
+			continue
+		}
+		m.desc = prometheus.NewDesc(name, help, variable, nil)
+		e.custom[name] = m
+	}
+}
+
+// columnIndex returns the position of a column in the result set or -1.
+func columnIndex(cols []string, name string) int {
+	for i, col := range cols {
+		if cleanName(name) == cleanName(col) {
+			return i
+		}
+	}
+	return -1
+}
+
+// labelValue converts a column value into a label value.
+func labelValue(v interface{}) string {
+	switch a := v.(type) {
+	case string:
+		return a
+	case float64:
+		// if value is integer
+		if a == float64(int64(a)) {
+			return strconv.Itoa(int(a))
+		}
+		return strconv.FormatFloat(a, 'e', -1, 64)
+	case int64:
+		return strconv.FormatInt(a, 10)
+	case time.Time:
+		return a.Format(time.RFC3339)
+	case []byte:
+		return string(a)
+	}
+	return ""
+}
+
+// metricValue converts a column value into a sample value. NULL is
+// handled as configured by null_value, other values that can't be converted
+// are dropped, logged once and counted if the row is fresh from the database.
+func (e *Exporter) metricValue(query *Query, metric string, v interface{}, fresh bool) (float64, bool) {
+	reason := "type"
+	if v == nil {
+		switch strings.ToLower(query.NullValue) {
+		case "nan":
+			return math.NaN(), true
+		case "", "skip":
+		default:
+			if f, err := strconv.ParseFloat(query.NullValue, 64); err == nil {
+				return f, true
+			}
+		}
+		reason = "null"
+	} else if f, ok := toFloat(v); ok {
+		return f, true
+	}
+	if !fresh {
+		return 0, false
+	}
+	e.droppedValues.WithLabelValues(query.Name, metric, reason).Inc()
+	key := query.Name + "/" + metric + "/" + reason
+	if !e.dropped[key] {
+		e.dropped[key] = true
+		log.Warnf("Dropping %s value %v (%T) of column %s in query %s", reason, v, v, metric, query.Name)
+	}
+	return 0, false
+}
+
+// customSample is one series of a custom metric before it is exported.
+type customSample struct {
+	metric  *customMetric
+	labels  []string
+	value   float64
+	count   uint64
+	buckets map[float64]uint64
+}
+
+// add merges a sample with the same label set into s according to mode.
+func (s *customSample) add(o *customSample, mode string) {
+	switch mode {
+	case "sum":
+		s.value += o.value
+		s.count += o.count
+		for le, v := range o.buckets {
+			s.buckets[le] += v
+		}
+	case "max":
+		if o.value > s.value {
+			*s = *o
+		}
+	default:
+		*s = *o
+	}
+}
+
+// exportCustom builds the custom metrics of a query from its result set.
+// Rows with the same label set are merged as configured by the query's
+// duplicates setting.
+func (e *Exporter) exportCustom(conn *Config, pdb container, query *Query, res *queryResult) error {
+	var (
+		samples    []*customSample
+		index      = make(map[string]*customSample)
+		duplicates int
+	)
+	// A cached result is exported again on every scrape, its dropped values
+	// are only counted the first time.
+	fresh := !res.exported
+	res.exported = true
+	cols := res.cols
+	keyIndex := -1
+	if len(query.KeyColumn) > 0 {
+		if keyIndex = columnIndex(cols, query.KeyColumn); keyIndex == -1 {
+			return fmt.Errorf("key column %s not found", query.KeyColumn)
+		}
+	}
+	for n, vals := range res.rows {
+		labels := []string{}
+		for _, label := range query.Labels {
+			if i := columnIndex(cols, label); i >= 0 {
+				labels = append(labels, labelValue(vals[i]))
+			} else {
+				labels = append(labels, "")
+			}
+		}
+		if keyIndex >= 0 {
+			key := labelValue(vals[keyIndex])
+			if !query.keyMatches(key) {
+				continue
+			}
+			labels = append(labels, cleanName(key))
+		}
+
+		for _, metric := range query.metrics() {
+			metricColumnIndex := columnIndex(cols, metric)
+			if metricColumnIndex == -1 {
+				//log.Infoln("Metric column '" + metric + "' not found")
+				continue
+			}
+			metricValue, ok := e.metricValue(query, metric, vals[metricColumnIndex], fresh)
+			if !ok {
+				continue
+			}
+
+			col := query.column(metric)
+			if col.Scale != 0 {
+				metricValue *= col.Scale
+			}
+			name := query.metricName(metric)
+			sample := &customSample{metric: e.custom[name], value: metricValue}
+			sample.labels = append([]string{}, labels...)
+			if !query.ownFamily(metric) {
+				sample.labels = append(sample.labels, metric)
+			}
+			sample.labels = append(sample.labels, conn.Database, conn.Instance)
+			sample.labels = append(sample.labels, pdb.labels()...)
+			if query.Duplicates == "rownum" {
+				sample.labels = append(sample.labels, strconv.Itoa(n+1))
+			}
+			if sample.metric.histogram {
+				sample.count, sample.buckets = histogramBuckets(col, cols, vals)
+			}
+
+			key := name + "\xff" + strings.Join(sample.labels, "\xff")
+			if prev, ok := index[key]; ok {
+				duplicates++
+				prev.add(sample, query.Duplicates)
+				continue
+			}
+			index[key] = sample
+			samples = append(samples, sample)
+		}
+	}
+
+	if duplicates > 0 {
+		switch query.Duplicates {
+		case "error":
+			return fmt.Errorf("%d rows with duplicate labels", duplicates)
+		case "sum", "max", "last":
+		default:
+			log.Warnln("Query", query.Name, "on", conn.Instance, "returned", duplicates,
+				"rows with duplicate labels, only the last one is exported")
+		}
+	}
+
+	for _, sample := range samples {
+		var pm prometheus.Metric
+		var err error
+		if sample.metric.histogram {
+			pm, err = prometheus.NewConstHistogram(sample.metric.desc, sample.count, sample.value, sample.buckets, sample.labels...)
+		} else {
+			pm, err = prometheus.NewConstMetric(sample.metric.desc, sample.metric.valueType, sample.value, sample.labels...)
+		}
+		if err != nil {
+			log.Errorln("Error exporting query", query.Name+":", err)
+			continue
+		}
+		e.customVals = append(e.customVals, pm)
+	}
+	return nil
+}
+
+// histogramBuckets reads the cumulative bucket counts and the total count of
+// a histogram column from a row.
+func histogramBuckets(col Column, cols []string, vals []interface{}) (uint64, map[float64]uint64) {
+	var count uint64
+	buckets := make(map[float64]uint64)
+	for bound, name := range col.Buckets {
+		le, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			log.Errorln("Invalid bucket bound", bound+":", err)
+			continue
+		}
+		i := columnIndex(cols, name)
+		if i == -1 {
+			continue
+		}
+		v, ok := toFloat(vals[i])
+		if !ok {
+			continue
+		}
+		if math.IsInf(le, 1) {
+			count = uint64(v)
+			continue
+		}
+		buckets[le] = uint64(v)
+		if uint64(v) > count {
+			count = uint64(v)
+		}
+	}
+	if i := columnIndex(cols, col.Count); len(col.Count) > 0 && i >= 0 {
+		if v, ok := toFloat(vals[i]); ok {
+			count = uint64(v)
+		}
+	}
+	return count, buckets
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// nopDriver gives a *sql.DB that never connects, enough for the state checks.
+type nopDriver struct{}
+
+func (nopDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("no database")
+}
+
+func init() {
+	sql.Register("nop", nopDriver{})
+}
+
+func TestAppliesTo(t *testing.T) {
+	db, err := sql.Open("nop", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	open := &Config{Database: "DB1", Instance: "db11", db: db, status: "OPEN", role: "PRIMARY", version: "19.3.0.0.0"}
+	mounted := &Config{Database: "DB1", Instance: "db12", db: db, status: "MOUNTED", role: "PHYSICAL STANDBY", version: "12.2.0.1.0"}
+	started := &Config{Database: "DB1", Instance: "db13", db: db, status: "STARTED", version: "19.3.0.0.0"}
+	down := &Config{Database: "DB1", Instance: "db14", status: "OPEN"}
+	tests := []struct {
+		name  string
+		query Query
+		conn  *Config
+		want  bool
+	}{
+		{"default on open", Query{}, open, true},
+		{"default on mounted", Query{}, mounted, true},
+		{"default on started", Query{}, started, false},
+		{"not connected", Query{}, down, false},
+		{"open on mounted", Query{Requires: "open"}, mounted, false},
+		{"started on started", Query{Requires: "started"}, started, true},
+		{"include other instance", Query{Instances: Instances{Include: []string{"db12"}}}, open, false},
+		{"include database", Query{Instances: Instances{Include: []string{"db1"}}}, open, true},
+		{"exclude instance", Query{Instances: Instances{Exclude: []string{"DB11"}}}, open, false},
+		{"role matches", Query{DatabaseRole: "physical standby"}, mounted, true},
+		{"role differs", Query{DatabaseRole: "PRIMARY"}, mounted, false},
+		{"min version reached", Query{MinVersion: "19.3"}, open, true},
+		{"min version missed", Query{MinVersion: "19.4"}, open, false},
+		{"max version prefix", Query{MaxVersion: "12.2"}, mounted, true},
+		{"max version exceeded", Query{MaxVersion: "12.1"}, mounted, false},
+	}
+	for _, tt := range tests {
+		if got := tt.query.appliesTo(tt.conn); got != tt.want {
+			t.Errorf("%s: appliesTo = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+var fqNameRe = regexp.MustCompile(`fqName: "([^"]*)"`)
+
+// exportRows exports rows as the result of query on a connection db/inst and
+// returns the metrics as sorted `name{labels} value` lines.
+func exportRows(t *testing.T, query Query, cols []string, rows ...[]interface{}) ([]string, error) {
+	e := NewExporter()
+	e.addCustomMetrics(&query)
+	res := &queryResult{cols: cols, rows: rows, time: time.Now()}
+	err := e.exportCustom(&Config{Database: "db", Instance: "inst"}, container{}, &query, res)
+	var out []string
+	for _, pm := range e.customVals {
+		var m dto.Metric
+		if err := pm.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		var labels []string
+		for _, l := range m.Label {
+			labels = append(labels, l.GetName()+"="+strconv.Quote(l.GetValue()))
+		}
+		var value string
+		switch {
+		case m.Counter != nil:
+			value = "counter " + strconv.FormatFloat(m.Counter.GetValue(), 'g', -1, 64)
+		case m.Histogram != nil:
+			value = "histogram " + strconv.FormatUint(m.Histogram.GetSampleCount(), 10) + " " +
+				strconv.FormatFloat(m.Histogram.GetSampleSum(), 'g', -1, 64)
+			for _, b := range m.Histogram.Bucket {
+				value += " " + strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64) + ":" + strconv.FormatUint(b.GetCumulativeCount(), 10)
+			}
+		default:
+			value = strconv.FormatFloat(m.Gauge.GetValue(), 'g', -1, 64)
+		}
+		name := fqNameRe.FindStringSubmatch(pm.Desc().String())[1]
+		out = append(out, name+"{"+strings.Join(labels, ",")+"} "+value)
+	}
+	sort.Strings(out)
+	return out, err
+}
+
+// exportCase is a query result and the metrics expected from it.
+type exportCase struct {
+	name  string
+	query Query
+	cols  []string
+	rows  [][]interface{}
+	want  []string
+	err   bool
+}
+
+func checkExport(t *testing.T, tests []exportCase) {
+	for _, tt := range tests {
+		got, err := exportRows(t, tt.query, tt.cols, tt.rows...)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v; want error %v", tt.name, err, tt.err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: exported\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestExportTypes(t *testing.T) {
+	checkExport(t, []exportCase{
+		{name: "counter with unit",
+			query: Query{Name: "events", Labels: []string{"event"}, Metrics: []string{"wait"},
+				Columns: map[string]Column{"wait": {Type: "Counter", Unit: "seconds"}}},
+			cols: []string{"EVENT", "WAIT"},
+			rows: [][]interface{}{{"db file", float64(1.5)}},
+			want: []string{`oracledb_custom_events_wait_seconds_total{database="db",dbinstance="inst",event="db file"} counter 1.5`}},
+		{name: "histogram",
+			query: Query{Name: "calls", Metrics: []string{"elapsed"},
+				Columns: map[string]Column{"elapsed": {Type: "histogram",
+					Buckets: map[string]string{"0.1": "le_01", "1": "le_1", "+Inf": "le_inf"}}}},
+			cols: []string{"ELAPSED", "LE_01", "LE_1", "LE_INF"},
+			rows: [][]interface{}{{float64(12.5), int64(3), int64(8), int64(10)}},
+			want: []string{`oracledb_custom_calls_elapsed{database="db",dbinstance="inst"} histogram 10 12.5 0.1:3 1:8`}},
+		{name: "scaled gauge",
+			query: Query{Name: "cpu", Metrics: []string{"cs"}, Columns: map[string]Column{"cs": {Scale: 0.01}}},
+			cols:  []string{"CS"},
+			rows:  [][]interface{}{{"150"}},
+			want:  []string{`oracledb_custom_cpu{database="db",dbinstance="inst",metric="cs"} 1.5`}},
+	})
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	cols := []string{"LE_1", "LE_10", "LE_INF", "TOTAL"}
+	vals := []interface{}{float64(2), float64(5), float64(6), nil}
+	tests := []struct {
+		name    string
+		col     Column
+		count   uint64
+		buckets map[float64]uint64
+	}{
+		{"inf bucket is the count",
+			Column{Buckets: map[string]string{"1": "le_1", "10": "le_10", "+Inf": "le_inf"}},
+			6, map[float64]uint64{1: 2, 10: 5}},
+		{"largest bucket without inf",
+			Column{Buckets: map[string]string{"1": "le_1", "10": "le_10"}},
+			5, map[float64]uint64{1: 2, 10: 5}},
+		{"invalid bound and missing column skipped",
+			Column{Buckets: map[string]string{"x": "le_1", "5": "missing", "10": "le_10"}},
+			5, map[float64]uint64{10: 5}},
+		{"NULL count column ignored",
+			Column{Buckets: map[string]string{"1": "le_1"}, Count: "total"},
+			2, map[float64]uint64{1: 2}},
+	}
+	for _, tt := range tests {
+		count, buckets := histogramBuckets(tt.col, cols, vals)
+		if count != tt.count || !reflect.DeepEqual(buckets, tt.buckets) {
+			t.Errorf("%s: histogramBuckets = %d %v; want %d %v", tt.name, count, buckets, tt.count, tt.buckets)
+		}
+	}
+
+	count, _ := histogramBuckets(Column{Buckets: map[string]string{"1": "le_1"}, Count: "total"},
+		cols, []interface{}{float64(2), nil, nil, int64(9)})
+	if count != 9 {
+		t.Errorf("histogramBuckets with count column = %d; want 9", count)
+	}
+}
+
+func TestExportNames(t *testing.T) {
+	cols := []string{"STATUS", "ACTIVE", "INACTIVE"}
+	rows := [][]interface{}{{"USER", int64(3), int64(4)}}
+	checkExport(t, []exportCase{
+		{name: "shared family",
+			query: Query{Name: "sessions", Labels: []string{"status"}, Metrics: []string{"active", "inactive"}},
+			cols:  cols, rows: rows,
+			want: []string{
+				`oracledb_custom_sessions{database="db",dbinstance="inst",metric="active",status="USER"} 3`,
+				`oracledb_custom_sessions{database="db",dbinstance="inst",metric="inactive",status="USER"} 4`}},
+		{name: "per column",
+			query: Query{Name: "sessions", Labels: []string{"status"}, Metrics: []string{"active", "inactive"}, PerColumn: true},
+			cols:  cols, rows: rows,
+			want: []string{
+				`oracledb_custom_sessions_active{database="db",dbinstance="inst",status="USER"} 3`,
+				`oracledb_custom_sessions_inactive{database="db",dbinstance="inst",status="USER"} 4`}},
+		{name: "query prefix",
+			query: Query{Name: "sessions", Metrics: []string{"active"}, Prefix: "sess"},
+			cols:  cols, rows: rows,
+			want: []string{`oracledb_sess{database="db",dbinstance="inst",metric="active"} 3`}},
+		{name: "unit not repeated",
+			query: Query{Name: "ts", Metrics: []string{"bytes"}, Columns: map[string]Column{"bytes": {Unit: "bytes"}}},
+			cols:  []string{"BYTES"},
+			rows:  [][]interface{}{{int64(1024)}},
+			want:  []string{`oracledb_custom_ts_bytes{database="db",dbinstance="inst"} 1024`}},
+	})
+
+	defer func(ns, prefix string) {
+		config.Namespace, config.Prefix = ns, prefix
+	}(config.Namespace, config.Prefix)
+	config.Namespace, config.Prefix = "app", "ora_"
+	checkExport(t, []exportCase{
+		{name: "global namespace and prefix",
+			query: Query{Name: "sessions", Metrics: []string{"active"}},
+			cols:  cols, rows: rows,
+			want: []string{`app_ora_sessions{database="db",dbinstance="inst",metric="active"} 3`}},
+		{name: "query prefix keeps namespace",
+			query: Query{Name: "sessions", Metrics: []string{"active"}, PerColumn: true, Prefix: "sess"},
+			cols:  cols, rows: rows,
+			want: []string{`app_sess_active{database="db",dbinstance="inst"} 3`}},
+	})
+}
+
+func TestExportDuplicates(t *testing.T) {
+	cols := []string{"OWNER", "CNT"}
+	rows := [][]interface{}{{"APP", int64(2)}, {"APP", int64(5)}, {"APP", int64(3)}, {"HR", int64(1)}}
+	query := func(duplicates string) Query {
+		return Query{Name: "objects", Labels: []string{"owner"}, Metrics: []string{"cnt"}, Duplicates: duplicates}
+	}
+	series := func(owner, value string) string {
+		return `oracledb_custom_objects{database="db",dbinstance="inst",metric="cnt",owner="` + owner + `"} ` + value
+	}
+	checkExport(t, []exportCase{
+		{name: "last", query: query(""), cols: cols, rows: rows,
+			want: []string{series("APP", "3"), series("HR", "1")}},
+		{name: "sum", query: query("SUM"), cols: cols, rows: rows,
+			want: []string{series("APP", "10"), series("HR", "1")}},
+		{name: "max", query: query("max"), cols: cols, rows: rows,
+			want: []string{series("APP", "5"), series("HR", "1")}},
+		{name: "error", query: query("error"), cols: cols, rows: rows, err: true},
+		{name: "error without duplicates", query: query("error"), cols: cols, rows: rows[2:],
+			want: []string{series("APP", "3"), series("HR", "1")}},
+		{name: "rownum", query: query("rownum"), cols: cols, rows: rows[1:],
+			want: []string{
+				`oracledb_custom_objects{database="db",dbinstance="inst",metric="cnt",owner="APP",rownum="1"} 5`,
+				`oracledb_custom_objects{database="db",dbinstance="inst",metric="cnt",owner="APP",rownum="2"} 3`,
+				`oracledb_custom_objects{database="db",dbinstance="inst",metric="cnt",owner="HR",rownum="3"} 1`}},
+	})
+}
+
+func TestCustomSampleAdd(t *testing.T) {
+	tests := []struct {
+		mode    string
+		value   float64
+		count   uint64
+		buckets map[float64]uint64
+	}{
+		{"sum", 5, 7, map[float64]uint64{1: 3, 10: 7}},
+		{"max", 3, 4, map[float64]uint64{1: 2, 10: 4}},
+		{"last", 3, 4, map[float64]uint64{1: 2, 10: 4}},
+	}
+	for _, tt := range tests {
+		s := &customSample{value: 2, count: 3, buckets: map[float64]uint64{1: 1, 10: 3}}
+		s.add(&customSample{value: 3, count: 4, buckets: map[float64]uint64{1: 2, 10: 4}}, tt.mode)
+		if s.value != tt.value || s.count != tt.count || !reflect.DeepEqual(s.buckets, tt.buckets) {
+			t.Errorf("add(%s) = %v %v %v; want %v %v %v", tt.mode, s.value, s.count, s.buckets, tt.value, tt.count, tt.buckets)
+		}
+	}
+
+	s := &customSample{value: 5}
+	s.add(&customSample{value: 3}, "max")
+	if s.value != 5 {
+		t.Errorf("add(max) replaced a larger value: %v", s.value)
+	}
+}
+
+func TestExportKeyValue(t *testing.T) {
+	cols := []string{"NAME", "VALUE"}
+	rows := [][]interface{}{{"user commits", int64(5)}, {"user rollbacks", int64(1)}, {"execute count", int64(9)}}
+	checkExport(t, []exportCase{
+		{name: "all keys",
+			query: Query{Name: "sysstat", KeyColumn: "name"},
+			cols:  cols, rows: rows,
+			want: []string{
+				`oracledb_custom_sysstat{database="db",dbinstance="inst",name="execute_count"} 9`,
+				`oracledb_custom_sysstat{database="db",dbinstance="inst",name="user_commits"} 5`,
+				`oracledb_custom_sysstat{database="db",dbinstance="inst",name="user_rollbacks"} 1`}},
+		{name: "include and exclude keys",
+			query: Query{Name: "sysstat", KeyColumn: "name", IncludeKeys: "^user ", ExcludeKeys: "rollbacks"},
+			cols:  cols, rows: rows,
+			want: []string{`oracledb_custom_sysstat{database="db",dbinstance="inst",name="user_commits"} 5`}},
+		{name: "labels and typed value column",
+			query: Query{Name: "sysstat", KeyColumn: "stat", ValueColumn: "total", Labels: []string{"class"},
+				Columns: map[string]Column{"total": {Type: "counter"}}},
+			cols: []string{"CLASS", "STAT", "TOTAL"},
+			rows: [][]interface{}{{"1", "user commits", int64(5)}},
+			want: []string{`oracledb_custom_sysstat_total{class="1",database="db",dbinstance="inst",stat="user_commits"} counter 5`}},
+	})
+}
+
+func TestBindArgs(t *testing.T) {
+	last := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	conn := &Config{Database: "db", Instance: "inst1", Vars: map[string]string{"Schema": "APP"}}
+	tests := []struct {
+		sql  string
+		want []interface{}
+	}{
+		{"SELECT 1 FROM dual", nil},
+		{"SELECT 1 FROM t WHERE ts > :last_scrape", []interface{}{sql.Named("last_scrape", last)}},
+		{"SELECT :database, :INSTANCE FROM dual", []interface{}{sql.Named("database", "db"), sql.Named("INSTANCE", "inst1")}},
+		{"SELECT 1 FROM t WHERE owner = :schema", []interface{}{sql.Named("schema", "APP")}},
+		{"SELECT 1 FROM t WHERE a = :database OR b = :database", []interface{}{sql.Named("database", "db")}},
+		{"SELECT ':database', to_char(d, 'HH24:MI:SS') FROM t", nil},
+		{"SELECT 1 FROM t WHERE a = :unknown AND b = :instance", []interface{}{sql.Named("instance", "inst1")}},
+	}
+	for _, tt := range tests {
+		got := bindArgs(conn, &Query{Sql: tt.sql}, last)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("bindArgs(%q) = %v; want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{"text", "text"},
+		{float64(42), "42"},
+		{float64(-1), "-1"},
+		{float64(0.5), "5e-01"},
+		{int64(7), "7"},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "2020-01-02T03:04:05Z"},
+		{[]byte("raw"), "raw"},
+		{nil, ""},
+		{true, ""},
+	}
+	for _, tt := range tests {
+		if got := labelValue(tt.in); got != tt.want {
+			t.Errorf("labelValue(%#v) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMetricValue(t *testing.T) {
+	tests := []struct {
+		null    string
+		in      interface{}
+		fresh   bool
+		want    float64
+		ok      bool
+		dropped float64
+	}{
+		{"", nil, true, 0, false, 1},
+		{"skip", nil, true, 0, false, 1},
+		{"skip", nil, false, 0, false, 0},
+		{"NaN", nil, true, math.NaN(), true, 0},
+		{"-1", nil, true, -1, true, 0},
+		{"bogus", nil, true, 0, false, 1},
+		{"", "3", true, 3, true, 0},
+		{"", "x", true, 0, false, 1},
+		{"", "x", false, 0, false, 0},
+	}
+	for _, tt := range tests {
+		e := NewExporter()
+		query := &Query{Name: "test", NullValue: tt.null}
+		got, ok := e.metricValue(query, "value", tt.in, tt.fresh)
+		if ok != tt.ok || (ok && got != tt.want && !(math.IsNaN(got) && math.IsNaN(tt.want))) {
+			t.Errorf("metricValue(null_value %q, %#v) = %v, %v; want %v, %v", tt.null, tt.in, got, ok, tt.want, tt.ok)
+		}
+		var dropped float64
+		for _, reason := range []string{"null", "type"} {
+			var m dto.Metric
+			if err := e.droppedValues.WithLabelValues("test", "value", reason).Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			dropped += m.Counter.GetValue()
+		}
+		if dropped != tt.dropped {
+			t.Errorf("metricValue(null_value %q, %#v, fresh %v) dropped %v; want %v", tt.null, tt.in, tt.fresh, dropped, tt.dropped)
+		}
+	}
+}
+
+func TestExportNull(t *testing.T) {
+	cols := []string{"OWNER", "CNT"}
+	rows := [][]interface{}{{"APP", nil}, {"HR", "2"}}
+	checkExport(t, []exportCase{
+		{name: "skip",
+			query: Query{Name: "objects", Labels: []string{"owner"}, Metrics: []string{"cnt"}},
+			cols:  cols, rows: rows,
+			want: []string{`oracledb_custom_objects{database="db",dbinstance="inst",metric="cnt",owner="HR"} 2`}},
+		{name: "number",
+			query: Query{Name: "objects", Labels: []string{"owner"}, Metrics: []string{"cnt"}, NullValue: "0"},
+			cols:  cols, rows: rows,
+			want: []string{
+				`oracledb_custom_objects{database="db",dbinstance="inst",metric="cnt",owner="APP"} 0`,
+				`oracledb_custom_objects{database="db",dbinstance="inst",metric="cnt",owner="HR"} 2`}},
+		{name: "date label",
+			query: Query{Name: "objects", Labels: []string{"created"}, Metrics: []string{"cnt"}},
+			cols:  []string{"CREATED", "CNT"},
+			rows:  [][]interface{}{{time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), int64(1)}},
+			want:  []string{`oracledb_custom_objects{created="2020-01-02T00:00:00Z",database="db",dbinstance="inst",metric="cnt"} 1`}},
+	})
+}
+
+func TestExportCachedDrops(t *testing.T) {
+	e := NewExporter()
+	query := Query{Name: "objects", Metrics: []string{"cnt"}, Interval: time.Minute}
+	e.addCustomMetrics(&query)
+	res := &queryResult{cols: []string{"CNT"}, rows: [][]interface{}{{nil}}, time: time.Now()}
+	for i := 0; i < 3; i++ {
+		if err := e.exportCustom(&Config{Database: "db", Instance: "inst"}, container{}, &query, res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var m dto.Metric
+	if err := e.droppedValues.WithLabelValues("objects", "cnt", "null").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Counter.GetValue() != 1 {
+		t.Errorf("dropped values of a cached result counted %v times; want 1", m.Counter.GetValue())
+	}
+}
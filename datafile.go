@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// ScrapeDatafiles collects per datafile sizes and status from dba_data_files,
+// the usable space of every tablespace including autoextend and the used
+// percentage of dba_tablespace_usage_metrics.
+func (e *Exporter) ScrapeDatafiles() {
+	for i := range config.Cfgs {
+		conn := &config.Cfgs[i]
+		if !conn.ready(stateOpen) {
+			continue
+		}
+		// Usable space of the ASM diskgroups, this already respects the redundancy.
+		diskgroups := make(map[string]float64)
+		rows, err := conn.db.Query(`SELECT name, greatest(usable_file_mb,0)*1024*1024 FROM v$asm_diskgroup`)
+		if err == nil {
+			for rows.Next() {
+				var name string
+				var free float64
+				if err := rows.Scan(&name, &free); err != nil {
+					break
+				}
+				diskgroups["+"+strings.ToUpper(name)] = free
+			}
+			rows.Close()
+		}
+
+		forEachContainer(conn, func(db queryer, pdb container) {
+			ctx := context.Background()
+			rows, err := db.QueryContext(ctx, `SELECT f.tablespace_name, f.file_name, nvl(f.bytes,0), nvl(f.maxbytes,0),
+                                      f.increment_by*t.block_size, f.autoextensible, f.status, f.online_status, t.bigfile
+                                 FROM dba_data_files f, dba_tablespaces t
+                                 WHERE f.tablespace_name = t.tablespace_name`)
+			if err != nil {
+				return
+			}
+			// growth is the autoextend headroom per tablespace and storage
+			// location, storage the free space of a location if known.
+			growth := make(map[string]map[string]float64)
+			storage := make(map[string]float64)
+			bigfile := make(map[string]string)
+			for rows.Next() {
+				var name, file, auto, status, online, big string
+				var bytes, maxbytes, increment float64
+				if err := rows.Scan(&name, &file, &bytes, &maxbytes, &increment, &auto, &status, &online, &big); err != nil {
+					break
+				}
+				labels := func(t string) []string {
+					return append([]string{conn.Database, conn.Instance, name, file, t}, pdb.labels()...)
+				}
+				e.datafile.WithLabelValues(labels("size")...).Set(bytes)
+				e.datafile.WithLabelValues(labels("max")...).Set(maxbytes)
+				e.datafile.WithLabelValues(labels("increment")...).Set(increment)
+				e.datafileInfo.WithLabelValues(append([]string{conn.Database, conn.Instance, name, file, auto, status, online}, pdb.labels()...)...).Set(1)
+
+				bigfile[name] = big
+				if growth[name] == nil {
+					growth[name] = make(map[string]float64)
+				}
+				if auto != "YES" || maxbytes <= bytes {
+					continue
+				}
+				location := file
+				if strings.HasPrefix(file, "+") {
+					location = strings.ToUpper(strings.SplitN(file, "/", 2)[0])
+					if free, ok := diskgroups[location]; ok {
+						storage[location] = free
+					}
+				} else if dev, free, ok := fsFree(file); ok {
+					location = dev
+					storage[location] = free
+				}
+				growth[name][location] += maxbytes - bytes
+			}
+			rows.Close()
+
+			free := make(map[string]float64)
+			rows, err = db.QueryContext(ctx, `SELECT tablespace_name, sum(bytes) FROM dba_free_space GROUP BY tablespace_name`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var bytes float64
+					if err := rows.Scan(&name, &bytes); err != nil {
+						break
+					}
+					free[name] = bytes
+				}
+				rows.Close()
+			}
+
+			// The free space of a filesystem or diskgroup is counted for every
+			// tablespace on it.
+			for name, locations := range growth {
+				usable := free[name]
+				for location, bytes := range locations {
+					if avail, ok := storage[location]; ok && avail < bytes {
+						bytes = avail
+					}
+					usable += bytes
+				}
+				e.tsUsable.WithLabelValues(append([]string{conn.Database, conn.Instance, name, bigfile[name]}, pdb.labels()...)...).Set(usable)
+			}
+
+			rows, err = db.QueryContext(ctx, `SELECT tablespace_name, used_percent FROM dba_tablespace_usage_metrics`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var used float64
+					if err := rows.Scan(&name, &used); err != nil {
+						break
+					}
+					e.tsUsed.WithLabelValues(append([]string{conn.Database, conn.Instance, name}, pdb.labels()...)...).Set(used)
+				}
+				rows.Close()
+			}
+		})
+	}
+}
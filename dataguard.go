@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+)
+
+var intervalRe = regexp.MustCompile(`^([+-])?(\d+) (\d+):(\d+):(\d+(\.\d+)?)$`)
+
+// parseInterval converts an Oracle INTERVAL DAY TO SECOND string like
+// "+00 00:01:05" into seconds.
+func parseInterval(s string) (float64, bool) {
+	m := intervalRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	days, _ := strconv.ParseFloat(m[2], 64)
+	hours, _ := strconv.ParseFloat(m[3], 64)
+	minutes, _ := strconv.ParseFloat(m[4], 64)
+	seconds, _ := strconv.ParseFloat(m[5], 64)
+	v := days*86400 + hours*3600 + minutes*60 + seconds
+	if m[1] == "-" {
+		v = -v
+	}
+	return v, true
+}
+
+// ScrapeDataguard collects Data Guard metrics. All views used can be read on
+// a primary as well as on a mounted standby.
+func (e *Exporter) ScrapeDataguard() {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, conn := range config.Cfgs {
+		if conn.ready(stateMounted) {
+			var role, mode, protection, switchover string
+			err = conn.db.QueryRow(`SELECT database_role, open_mode, protection_mode, switchover_status
+                                FROM v$database`).Scan(&role, &mode, &protection, &switchover)
+			if err != nil {
+				continue
+			}
+			e.dataguard.WithLabelValues(conn.Database, conn.Instance, role, mode, protection, switchover).Set(1)
+
+			//name
+			//transport lag      +00 00:00:00
+			//apply lag          +00 00:00:03
+			//apply finish time  +00 00:00:00.000
+			rows, err = conn.db.Query(`SELECT name, value FROM v$dataguard_stats
+                                 WHERE name in ('transport lag','apply lag','apply finish time')`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var value sql.NullString
+					if err := rows.Scan(&name, &value); err != nil {
+						break
+					}
+					if seconds, ok := parseInterval(value.String); ok {
+						e.dataguardLag.WithLabelValues(conn.Database, conn.Instance, cleanName(name)).Set(seconds)
+					}
+				}
+				rows.Close()
+			}
+
+			// v$dataguard_process replaces v$managed_standby since 12.2
+			rows, err = conn.db.Query(`SELECT name, action, count(*) FROM v$dataguard_process GROUP BY name, action`)
+			if err != nil {
+				rows, err = conn.db.Query(`SELECT process, status, count(*) FROM v$managed_standby GROUP BY process, status`)
+			}
+			if err == nil {
+				for rows.Next() {
+					var process string
+					var status string
+					var value float64
+					if err := rows.Scan(&process, &status, &value); err != nil {
+						break
+					}
+					e.dataguardProcess.WithLabelValues(conn.Database, conn.Instance, process, status).Set(value)
+				}
+				rows.Close()
+			}
+
+			rows, err = conn.db.Query(`SELECT s.dest_name, d.destination, s.status, nvl(s.gap_status,'NONE'), nvl(s.error,d.error)
+                                 FROM v$archive_dest_status s, v$archive_dest d
+                                 WHERE s.dest_id = d.dest_id AND s.status != 'INACTIVE'`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var dest sql.NullString
+					var status string
+					var gap string
+					var message sql.NullString
+					if err := rows.Scan(&name, &dest, &status, &gap, &message); err != nil {
+						break
+					}
+					value := 0.0
+					if status == "ERROR" || len(message.String) > 0 {
+						value = 1
+					}
+					e.archiveDest.WithLabelValues(conn.Database, conn.Instance, name, dest.String, status, gap, message.String).Set(value)
+				}
+				rows.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"+00 00:00:05", 5, true},
+		{"+01 02:03:04", 93784, true},
+		{"-00 00:01:00", -60, true},
+		{"00 00:00:01.5", 1.5, true},
+		{"", 0, false},
+		{"5 seconds", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseInterval(tt.in)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseInterval(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
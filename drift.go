@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Baseline lists the expected configuration of databases in groups. A group
+// without databases applies to all connections, a later group overrides the
+// expected values of an earlier one.
+type Baseline struct {
+	Groups []BaselineGroup `yaml:"groups"`
+}
+
+type BaselineGroup struct {
+	Name         string                       `yaml:"name"`
+	Databases    []string                     `yaml:"databases"`
+	Parameters   map[string]string            `yaml:"parameters"`
+	Profiles     map[string]map[string]string `yaml:"profiles"`
+	Redo         RedoRule                     `yaml:"redo"`
+	Controlfiles ControlfileRule              `yaml:"controlfiles"`
+}
+
+// RedoRule is the minimum number of online redo log groups and of members in
+// every group.
+type RedoRule struct {
+	MinGroups  int `yaml:"min_groups"`
+	MinMembers int `yaml:"min_members"`
+}
+
+type ControlfileRule struct {
+	MinCopies int `yaml:"min_copies"`
+}
+
+// drift is the result of one baseline check.
+type drift struct {
+	check    string
+	expected string
+	actual   string
+}
+
+func (d drift) ok() bool {
+	if strings.HasPrefix(d.expected, ">=") {
+		min, _ := strconv.Atoi(strings.TrimPrefix(d.expected, ">="))
+		actual, err := strconv.Atoi(d.actual)
+		return err == nil && actual >= min
+	}
+	return strings.EqualFold(strings.TrimSpace(d.expected), strings.TrimSpace(d.actual))
+}
+
+var baseline Baseline
+
+// loadBaseline reads the baseline file of the config. Relative paths are taken
+// from the directory of the config file.
+func loadBaseline() error {
+	file := config.Baseline
+	if len(file) == 0 {
+		return nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(*configFile), file)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(content, &baseline); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	return nil
+}
+
+// expectations merges the groups of the baseline that apply to a connection.
+func expectations(conn *Config) BaselineGroup {
+	exp := BaselineGroup{
+		Parameters: make(map[string]string),
+		Profiles:   make(map[string]map[string]string),
+	}
+	for _, g := range baseline.Groups {
+		if len(g.Databases) > 0 {
+			found := false
+			for _, db := range g.Databases {
+				if strings.EqualFold(db, conn.Database) {
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		for name, value := range g.Parameters {
+			exp.Parameters[strings.ToLower(name)] = value
+		}
+		for profile, limits := range g.Profiles {
+			profile = strings.ToUpper(profile)
+			if exp.Profiles[profile] == nil {
+				exp.Profiles[profile] = make(map[string]string)
+			}
+			for resource, value := range limits {
+				exp.Profiles[profile][strings.ToUpper(resource)] = value
+			}
+		}
+		if g.Redo.MinGroups > 0 {
+			exp.Redo.MinGroups = g.Redo.MinGroups
+		}
+		if g.Redo.MinMembers > 0 {
+			exp.Redo.MinMembers = g.Redo.MinMembers
+		}
+		if g.Controlfiles.MinCopies > 0 {
+			exp.Controlfiles.MinCopies = g.Controlfiles.MinCopies
+		}
+	}
+	return exp
+}
+
+// checkDrift compares the live configuration of a connection with the
+// baseline. Profiles are only checked on an open database.
+func checkDrift(conn *Config) ([]drift, error) {
+	var (
+		rows    *sql.Rows
+		err     error
+		results []drift
+	)
+	exp := expectations(conn)
+
+	if len(exp.Parameters) > 0 {
+		actual := make(map[string]string)
+		rows, err = conn.db.Query(`SELECT name, value FROM v$parameter`)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name string
+			var value sql.NullString
+			if err := rows.Scan(&name, &value); err != nil {
+				break
+			}
+			actual[name] = value.String
+		}
+		rows.Close()
+		for name, value := range exp.Parameters {
+			results = append(results, drift{"parameter:" + name, value, actual[name]})
+		}
+	}
+
+	if len(exp.Profiles) > 0 && conn.ready(stateOpen) {
+		actual := make(map[string]string)
+		rows, err = conn.db.Query(`SELECT profile, resource_name, limit FROM dba_profiles`)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var profile, resource, limit string
+			if err := rows.Scan(&profile, &resource, &limit); err != nil {
+				break
+			}
+			actual[profile+":"+resource] = limit
+		}
+		rows.Close()
+		for profile, limits := range exp.Profiles {
+			for resource, value := range limits {
+				results = append(results, drift{"profile:" + profile + ":" + resource, value, actual[profile+":"+resource]})
+			}
+		}
+	}
+
+	if (exp.Redo.MinGroups > 0 || exp.Redo.MinMembers > 0) && conn.ready(stateMounted) {
+		var groups, members int
+		err = conn.db.QueryRow(`SELECT count(*), nvl(min(members),0) FROM v$log
+                                WHERE thread# = (SELECT thread# FROM v$instance)`).Scan(&groups, &members)
+		if err != nil {
+			return nil, err
+		}
+		if exp.Redo.MinGroups > 0 {
+			results = append(results, drift{"redo_groups", ">=" + strconv.Itoa(exp.Redo.MinGroups), strconv.Itoa(groups)})
+		}
+		if exp.Redo.MinMembers > 0 {
+			results = append(results, drift{"redo_members", ">=" + strconv.Itoa(exp.Redo.MinMembers), strconv.Itoa(members)})
+		}
+	}
+
+	if exp.Controlfiles.MinCopies > 0 {
+		var copies int
+		err = conn.db.QueryRow(`SELECT count(*) FROM v$controlfile`).Scan(&copies)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, drift{"controlfiles", ">=" + strconv.Itoa(exp.Controlfiles.MinCopies), strconv.Itoa(copies)})
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].check < results[j].check })
+	return results, nil
+}
+
+// ScrapeDrift compares every connection with the baseline, checks that match
+// are exported with 0, differences with 1.
+func (e *Exporter) ScrapeDrift() {
+	for _, conn := range config.Cfgs {
+		if conn.db != nil {
+			results, err := checkDrift(&conn)
+			if err != nil {
+				continue
+			}
+			for _, d := range results {
+				value := 0.0
+				if !d.ok() {
+					value = 1
+				}
+				e.configDrift.WithLabelValues(conn.Database, conn.Instance, d.check, d.expected, d.actual).Set(value)
+			}
+		}
+	}
+}
+
+// driftReport prints the differences of all connections to the baseline and
+// returns the exit code, 1 if there are differences or a check failed.
+func driftReport() int {
+	code := 0
+	for _, conn := range config.Cfgs {
+		if conn.db == nil {
+			continue
+		}
+		results, err := checkDrift(&conn)
+		if err != nil {
+			fmt.Printf("%s/%s: %v\n", conn.Database, conn.Instance, err)
+			code = 1
+			continue
+		}
+		for _, d := range results {
+			if !d.ok() {
+				fmt.Printf("%s/%s: %s expected %q, actual %q\n", conn.Database, conn.Instance, d.check, d.expected, d.actual)
+				code = 1
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// fsFree returns the device and the bytes available to unprivileged users of
+// the filesystem holding a file. It fails if the exporter does not run on the
+// database server.
+func fsFree(file string) (string, float64, bool) {
+	dir := filepath.Dir(file)
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", 0, false
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return "", 0, false
+	}
+	sys, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", 0, false
+	}
+	return strconv.FormatUint(uint64(sys.Dev), 10), float64(st.Bavail) * float64(st.Bsize), true
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+// fsFree is not implemented on Windows, Solaris and the other platforms
+// without statfs, autoextend headroom is not limited by the free space of
+// the filesystem.
+func fsFree(file string) (string, float64, bool) {
+	return "", 0, false
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"net"
 	"net/http"
-	"strconv"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-oci8"
@@ -25,51 +28,135 @@ type Exporter struct {
 	duration, error prometheus.Gauge
 	totalScrapes    prometheus.Counter
 	scrapeErrors    *prometheus.CounterVec
+	droppedValues   *prometheus.CounterVec
 	session         *prometheus.GaugeVec
-	sysstat         *prometheus.GaugeVec
+	sysstat         *constVec
 	waitclass       *prometheus.GaugeVec
 	sysmetric       *prometheus.GaugeVec
 	interconnect    *prometheus.GaugeVec
 	uptime          *prometheus.GaugeVec
 	up              *prometheus.GaugeVec
+	instance        *prometheus.GaugeVec
 	tablespace      *prometheus.GaugeVec
-	recovery        *prometheus.GaugeVec
+	datafile        *prometheus.GaugeVec
+	datafileInfo    *prometheus.GaugeVec
+	tsUsable        *prometheus.GaugeVec
+	tsUsed          *prometheus.GaugeVec
+	recoveryUsed    *prometheus.GaugeVec
+	recoveryRecl    *prometheus.GaugeVec
+	recoveryDest    *prometheus.GaugeVec
+	archivelogBytes *prometheus.GaugeVec
 	redo            *prometheus.GaugeVec
+	redoSwitches    *constVec
+	redoBytes       *constVec
+	redoLog         *prometheus.GaugeVec
+	redoLogfile     *prometheus.GaugeVec
+	redoActive      *prometheus.GaugeVec
+	redoWaits       *constVec
+	redoWaitTime    *constVec
 	cache           *prometheus.GaugeVec
 	alertlog        *prometheus.GaugeVec
 	alertdate       *prometheus.GaugeVec
 	services        *prometheus.GaugeVec
+	resourceCurrent *prometheus.GaugeVec
+	resourceMax     *prometheus.GaugeVec
+	resourceLimit   *prometheus.GaugeVec
 	parameter       *prometheus.GaugeVec
+	parameterInfo   *prometheus.GaugeVec
+	configDrift     *prometheus.GaugeVec
 	//query           *prometheus.GaugeVec
-	asmspace   *prometheus.GaugeVec
-	tablerows  *prometheus.GaugeVec
-	tablebytes *prometheus.GaugeVec
-	indexbytes *prometheus.GaugeVec
-	lobbytes   *prometheus.GaugeVec
-	lastIp     string
-	vTabRows   bool
-	vTabBytes  bool
-	vIndBytes  bool
-	vLobBytes  bool
-	vRecovery  bool
-	custom     map[string]*prometheus.GaugeVec
+	asmspace         *prometheus.GaugeVec
+	dataguard        *prometheus.GaugeVec
+	dataguardLag     *prometheus.GaugeVec
+	dataguardProcess *prometheus.GaugeVec
+	archiveDest      *prometheus.GaugeVec
+	rmanBackup       *prometheus.GaugeVec
+	rmanJobs         *prometheus.GaugeVec
+	rmanDuration     *prometheus.GaugeVec
+	rmanBytes        *prometheus.GaugeVec
+	rmanPieces       *prometheus.GaugeVec
+	waitevents       *constVec
+	waiteventTime    *constVec
+	ash              *prometheus.GaugeVec
+	undoBytes        *prometheus.GaugeVec
+	undoRetention    *prometheus.GaugeVec
+	undoMaxQuery     *prometheus.GaugeVec
+	undoErrors       *prometheus.GaugeVec
+	tempUsed         *prometheus.GaugeVec
+	tempSession      *prometheus.GaugeVec
+	blocked          *prometheus.GaugeVec
+	blockedWait      *prometheus.GaugeVec
+	blockingDepth    *prometheus.GaugeVec
+	blocking         *prometheus.GaugeVec
+	longops          *prometheus.GaugeVec
+	longopsProgress  *prometheus.GaugeVec
+	longopsRemaining *prometheus.GaugeVec
+	sqlElapsed       *constVec
+	sqlCpu           *constVec
+	sqlGets          *constVec
+	sqlExecs         *constVec
+	tablerows        *prometheus.GaugeVec
+	tablebytes       *prometheus.GaugeVec
+	indexbytes       *prometheus.GaugeVec
+	lobbytes         *prometheus.GaugeVec
+	lastIp           string
+	vTabRows         bool
+	vTabBytes        bool
+	vIndBytes        bool
+	vLobBytes        bool
+	vRecovery        bool
+	vRman            bool
+	vWaitevents      bool
+	vTopsql          bool
+	vBlocking        bool
+	vUndo            bool
+	vDatafiles       bool
+	custom           map[string]*customMetric
+	customVals       []prometheus.Metric
+	results          map[string]*queryResult
+	lastRun          map[string]time.Time
+	dropped          map[string]bool
+	sqlStats         map[string]map[string]*sqlStat
+	sqlScraped       map[string]time.Time
+	started          time.Time
+	// mu serializes scrapes, Collect resets and refills the shared vectors,
+	// maps and caches above.
+	mu sync.Mutex
 }
 
 var (
 	// Version will be set at build time.
-	Version       = "1.1.5"
-	listenAddress = flag.String("web.listen-address", ":9161", "Address to listen on for web interface and telemetry.")
-	metricPath    = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
-	pMetrics      = flag.Bool("defaultmetrics", true, "Expose standard metrics")
-	pTabRows      = flag.Bool("tablerows", false, "Expose Table rows (CAN TAKE VERY LONG)")
-	pTabBytes     = flag.Bool("tablebytes", false, "Expose Table size (CAN TAKE VERY LONG)")
-	pIndBytes     = flag.Bool("indexbytes", false, "Expose Index size for any Table (CAN TAKE VERY LONG)")
-	pLobBytes     = flag.Bool("lobbytes", false, "Expose Lobs size for any Table (CAN TAKE VERY LONG)")
-	pRecovery     = flag.Bool("recovery", false, "Expose Recovery percentage usage of FRA (CAN TAKE VERY LONG)")
-	configFile    = flag.String("configfile", "oracle.conf", "ConfigurationFile in YAML format.")
-	logFile       = flag.String("logfile", "exporter.log", "Logfile for parsed Oracle Alerts.")
-	accessFile    = flag.String("accessfile", "access.conf", "Last access for parsed Oracle Alerts.")
-	landingPage   = []byte(`<html>
+	Version        = "1.1.5"
+	listenAddress  = flag.String("web.listen-address", ":9161", "Address to listen on for web interface and telemetry.")
+	metricPath     = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+	pMetrics       = flag.Bool("defaultmetrics", true, "Expose standard metrics")
+	pTabRows       = flag.Bool("tablerows", false, "Expose Table rows (CAN TAKE VERY LONG)")
+	pTabBytes      = flag.Bool("tablebytes", false, "Expose Table size (CAN TAKE VERY LONG)")
+	pTabParts      = flag.Bool("tablebytes.partitions", false, "Expose Table size per partition and subpartition")
+	pIndBytes      = flag.Bool("indexbytes", false, "Expose Index size for any Table (CAN TAKE VERY LONG)")
+	pLobBytes      = flag.Bool("lobbytes", false, "Expose Lobs size for any Table (CAN TAKE VERY LONG)")
+	pDatafiles     = flag.Bool("datafiles", false, "Expose datafile sizes and usable tablespace space with autoextend")
+	pRecovery      = flag.Bool("recovery", false, "Expose FRA usage and archivelog generation (CAN TAKE VERY LONG)")
+	pRman          = flag.Bool("rman", false, "Expose RMAN backup status and age")
+	rmanWindow     = flag.Duration("rman.window", 24*time.Hour, "Time window for RMAN backup jobs counted by status.")
+	pWaitevents    = flag.Bool("waitevents", false, "Expose top wait events (v$system_event)")
+	pWaiteventsTop = flag.Int("waitevents.top", 20, "Number of wait events and active session groups exposed.")
+	pAsh           = flag.Bool("ash", false, "Expose active sessions from v$active_session_history (REQUIRES DIAGNOSTICS PACK LICENSE)")
+	pAshInterval   = flag.Duration("ash.interval", time.Minute, "Time window of v$active_session_history samples.")
+	pTopsql        = flag.Bool("topsql", false, "Expose top SQL statistics (v$sqlstats)")
+	pTopsqlTop     = flag.Int("topsql.top", 10, "Number of statements exposed per statistic.")
+	pTopsqlText    = flag.Int("topsql.text", 0, "Length of the sql_text label, 0 to leave it out.")
+	pTopsqlSchema  = flag.Bool("topsql.schema", false, "Add the parsing schema of a statement as label.")
+	pDriftReport   = flag.Bool("drift.report", false, "Print the differences to the baseline of the config and exit.")
+	pUndo          = flag.Bool("undo", false, "Expose undo and temp usage (dba_undo_extents/v$undostat/v$tempseg_usage)")
+	pUndoTop       = flag.Int("undo.top", 10, "Number of temp users exposed.")
+	pBlocking      = flag.Bool("blocking", false, "Expose blocked sessions and long operations (v$session/v$session_longops)")
+	pBlockingTop   = flag.Int("blocking.top", 10, "Number of blockers and long operations exposed.")
+	pBlockers      = flag.Bool("blocking.details", false, "Expose username, program and sql_id of blocking sessions.")
+	configFile     = flag.String("configfile", "oracle.conf", "ConfigurationFile in YAML format.")
+	logFile        = flag.String("logfile", "exporter.log", "Logfile for parsed Oracle Alerts.")
+	accessFile     = flag.String("accessfile", "access.conf", "Last access for parsed Oracle Alerts.")
+	landingPage    = []byte(`<html>
                           <head><title>Prometheus Oracle exporter</title></head>
                           <body>
                             <h1>Prometheus Oracle exporter</h1><p>
@@ -78,7 +165,13 @@ var (
                             <a href='` + *metricPath + `?tablebytes=true'>Metrics with tablebytes</a></p>
                             <a href='` + *metricPath + `?indexbytes=true'>Metrics with indexbytes</a></p>
                             <a href='` + *metricPath + `?lobbytes=true'>Metrics with lobbytes</a></p>
+                            <a href='` + *metricPath + `?datafiles=true'>Metrics with datafiles</a></p>
                             <a href='` + *metricPath + `?recovery=true'>Metrics with recovery</a></p>
+                            <a href='` + *metricPath + `?rman=true'>Metrics with rman</a></p>
+                            <a href='` + *metricPath + `?waitevents=true'>Metrics with waitevents</a></p>
+                            <a href='` + *metricPath + `?topsql=true'>Metrics with topsql</a></p>
+                            <a href='` + *metricPath + `?blocking=true'>Metrics with blocking</a></p>
+                            <a href='` + *metricPath + `?undo=true'>Metrics with undo</a></p>
                           </body>
                           </html>`)
 )
@@ -104,6 +197,12 @@ func NewExporter() *Exporter {
 			Name:      "scrape_errors_total",
 			Help:      "Total number of times an error occured scraping a Oracle database.",
 		}, []string{"collector"}),
+		droppedValues: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: exporter,
+			Name:      "dropped_values_total",
+			Help:      "Total number of custom query values that could not be converted to a number.",
+		}, []string{"query", "column", "reason"}),
 		error: prometheus.NewGauge(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Subsystem: exporter,
@@ -113,23 +212,23 @@ func NewExporter() *Exporter {
 		sysmetric: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "sysmetric",
-			Help:      "Gauge metric with read/write pysical IOPs/bytes (v$sysmetric).",
+			Help:      "Gauge metric with system metrics like read/write pysical IOPs/bytes (v$sysmetric).",
 		}, []string{"database", "dbinstance", "type"}),
 		waitclass: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "waitclass",
 			Help:      "Gauge metric with Waitevents (v$waitclassmetric).",
 		}, []string{"database", "dbinstance", "type"}),
-		sysstat: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		sysstat: newCounterVec(prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "sysstat",
-			Help:      "Gauge metric with commits/rollbacks/parses (v$sysstat).",
+			Name:      "sysstat_total",
+			Help:      "Counter metric with statistics like commits/rollbacks/parses (v$sysstat).",
 		}, []string{"database", "dbinstance", "type"}),
 		session: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "session",
 			Help:      "Gauge metric user/system active/passive sessions (v$session).",
-		}, []string{"database", "dbinstance", "type", "state"}),
+		}, append([]string{"database", "dbinstance", "type", "state"}, pdbLabels()...)),
 		uptime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "uptime",
@@ -139,22 +238,92 @@ func NewExporter() *Exporter {
 			Namespace: namespace,
 			Name:      "tablespace",
 			Help:      "Gauge metric with total/free size of the Tablespaces.",
-		}, []string{"database", "dbinstance", "type", "name", "contents", "autoextend"}),
+		}, append([]string{"database", "dbinstance", "type", "name", "contents", "autoextend"}, pdbLabels()...)),
+		datafile: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "datafile_bytes",
+			Help:      "Gauge metric with size/max/increment bytes of the datafiles (dba_data_files).",
+		}, append([]string{"database", "dbinstance", "tablespace", "file", "type"}, pdbLabels()...)),
+		datafileInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "datafile_info",
+			Help:      "Autoextend, status and online status of the datafiles (dba_data_files).",
+		}, append([]string{"database", "dbinstance", "tablespace", "file", "autoextensible", "status", "online_status"}, pdbLabels()...)),
+		tsUsable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tablespace_usable_bytes",
+			Help:      "Gauge metric with free bytes of a tablespace including autoextend, limited by the free space of filesystem or diskgroup.",
+		}, append([]string{"database", "dbinstance", "tablespace", "bigfile"}, pdbLabels()...)),
+		tsUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tablespace_used_percent",
+			Help:      "Gauge metric with used percentage of the maximum tablespace size (dba_tablespace_usage_metrics).",
+		}, append([]string{"database", "dbinstance", "tablespace"}, pdbLabels()...)),
 		interconnect: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "interconnect",
 			Help:      "Gauge metric with interconnect block transfers (v$sysstat).",
 		}, []string{"database", "dbinstance", "type"}),
-		recovery: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		recoveryUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
-			Name:      "recovery",
-			Help:      "Gauge metric with percentage usage of FRA (v$recovery_file_dest).",
-		}, []string{"database", "dbinstance", "type"}),
+			Name:      "recovery_used_percent",
+			Help:      "Gauge metric with percentage usage of FRA per file type (v$recovery_area_usage).",
+		}, []string{"database", "dbinstance", "file_type"}),
+		recoveryRecl: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "recovery_reclaimable_percent",
+			Help:      "Gauge metric with reclaimable percentage of FRA per file type (v$recovery_area_usage).",
+		}, []string{"database", "dbinstance", "file_type"}),
+		recoveryDest: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "recovery_dest_bytes",
+			Help:      "Gauge metric with limit/used/reclaimable bytes of the FRA (v$recovery_file_dest).",
+		}, []string{"database", "dbinstance", "name", "type"}),
+		archivelogBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "archivelog_hourly_bytes",
+			Help:      "Gauge metric with bytes of archived logs generated in the last hour (v$archived_log).",
+		}, []string{"database", "dbinstance"}),
 		redo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "redo",
 			Help:      "Gauge metric with Redo log switches over last 5 min (v$log_history).",
 		}, []string{"database", "dbinstance"}),
+		redoSwitches: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redo_log_switches_total",
+			Help:      "Counter metric with log switches per thread, the current log sequence (v$log).",
+		}, []string{"database", "dbinstance", "thread"}),
+		redoBytes: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redo_bytes_total",
+			Help:      "Counter metric with bytes of redo generated (v$sysstat).",
+		}, []string{"database", "dbinstance"}),
+		redoLog: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "redo_log_bytes",
+			Help:      "Gauge metric with size of the online redo log groups with their status (v$log).",
+		}, []string{"database", "dbinstance", "thread", "group", "status"}),
+		redoLogfile: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "redo_logfile",
+			Help:      "Whether an online redo log member is usable, 0 for INVALID/STALE/DELETED (v$logfile).",
+		}, []string{"database", "dbinstance", "group", "member", "status"}),
+		redoActive: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "redo_log_active",
+			Help:      "Gauge metric with number of ACTIVE redo log groups still needed for crash recovery (v$log).",
+		}, []string{"database", "dbinstance", "thread"}),
+		redoWaits: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redo_wait_event_waits_total",
+			Help:      "Counter metric with number of waits of log file sync and log file switch events (v$system_event).",
+		}, []string{"database", "dbinstance", "event"}),
+		redoWaitTime: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redo_wait_event_time_seconds_total",
+			Help:      "Counter metric with time waited of log file sync and log file switch events (v$system_event).",
+		}, []string{"database", "dbinstance", "event"}),
 		cache: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "cachehitratio",
@@ -165,6 +334,11 @@ func NewExporter() *Exporter {
 			Name:      "up",
 			Help:      "Whether the Oracle server is up.",
 		}, []string{"database", "dbinstance"}),
+		instance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "instance_info",
+			Help:      "Status, open mode and role of the Instance (v$instance/v$database).",
+		}, []string{"database", "dbinstance", "status", "open_mode", "database_role", "logins", "version"}),
 		alertlog: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "error",
@@ -180,11 +354,36 @@ func NewExporter() *Exporter {
 			Name:      "services",
 			Help:      "Active Oracle Services (v$active_services).",
 		}, []string{"database", "dbinstance", "name"}),
+		resourceCurrent: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "resource_current_utilization",
+			Help:      "Gauge metric with current utilization of a resource like processes/sessions (v$resource_limit).",
+		}, []string{"database", "dbinstance", "resource"}),
+		resourceMax: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "resource_max_utilization",
+			Help:      "Gauge metric with maximum utilization of a resource since instance start (v$resource_limit).",
+		}, []string{"database", "dbinstance", "resource"}),
+		resourceLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "resource_limit",
+			Help:      "Gauge metric with limit of a resource, omitted if UNLIMITED (v$resource_limit).",
+		}, []string{"database", "dbinstance", "resource"}),
 		parameter: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "parameter",
-			Help:      "oracle Configuration Parameters (v$parameter).",
-		}, []string{"database", "dbinstance", "name"}),
+			Help:      "oracle Configuration Parameters with a numeric value (v$parameter).",
+		}, []string{"database", "dbinstance", "name", "isdefault", "ismodified"}),
+		parameterInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "parameter_info",
+			Help:      "oracle Configuration Parameters with a string or boolean value (v$parameter).",
+		}, []string{"database", "dbinstance", "name", "value", "isdefault", "ismodified"}),
+		configDrift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "config_drift",
+			Help:      "Whether a configuration check differs from the baseline (1 for drift, 0 for match).",
+		}, []string{"database", "dbinstance", "check", "expected", "actual"}),
 		// query: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		// 	Namespace: namespace,
 		// 	Name:      "query",
@@ -195,6 +394,151 @@ func NewExporter() *Exporter {
 			Name:      "asmspace",
 			Help:      "Gauge metric with total/free size of the ASM Diskgroups.",
 		}, []string{"database", "dbinstance", "type", "name"}),
+		dataguard: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dataguard",
+			Help:      "Database role, open mode and protection mode (v$database).",
+		}, []string{"database", "dbinstance", "role", "open_mode", "protection_mode", "switchover_status"}),
+		dataguardLag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dataguard_lag_seconds",
+			Help:      "Gauge metric with transport/apply lag and apply finish time of a standby (v$dataguard_stats).",
+		}, []string{"database", "dbinstance", "type"}),
+		dataguardProcess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dataguard_process",
+			Help:      "Gauge metric with number of Data Guard processes per state (v$dataguard_process/v$managed_standby).",
+		}, []string{"database", "dbinstance", "process", "status"}),
+		archiveDest: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "archive_dest_error",
+			Help:      "Whether an archive destination has an error (v$archive_dest_status/v$archive_dest).",
+		}, []string{"database", "dbinstance", "name", "destination", "status", "gap_status", "error"}),
+		rmanBackup: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rman_backup_unix_seconds",
+			Help:      "Unixtime of the last successful RMAN backup per type (v$rman_backup_job_details).",
+		}, []string{"database", "dbinstance", "type"}),
+		rmanJobs: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rman_jobs",
+			Help:      "Gauge metric with number of RMAN jobs per type/status started within rman.window (v$rman_backup_job_details).",
+		}, []string{"database", "dbinstance", "type", "status"}),
+		rmanDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rman_last_job_duration_seconds",
+			Help:      "Gauge metric with duration of the last RMAN job per type (v$rman_backup_job_details).",
+		}, []string{"database", "dbinstance", "type", "status"}),
+		rmanBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rman_last_job_bytes",
+			Help:      "Gauge metric with bytes written by the last RMAN job per type (v$rman_backup_job_details).",
+		}, []string{"database", "dbinstance", "type", "status"}),
+		rmanPieces: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rman_backup_pieces_bytes",
+			Help:      "Gauge metric with bytes of available backup pieces per type (v$backup_set/v$backup_piece).",
+		}, []string{"database", "dbinstance", "type"}),
+		waitevents: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wait_event_waits_total",
+			Help:      "Counter metric with number of waits of the top wait events (v$system_event).",
+		}, []string{"database", "dbinstance", "event", "wait_class"}),
+		waiteventTime: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wait_event_time_seconds_total",
+			Help:      "Counter metric with time waited of the top wait events (v$system_event).",
+		}, []string{"database", "dbinstance", "event", "wait_class"}),
+		ash: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ash_active_sessions",
+			Help:      "Gauge metric with average active sessions per wait class/event/sql_id (v$active_session_history).",
+		}, []string{"database", "dbinstance", "wait_class", "event", "sql_id"}),
+		undoBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "undo_bytes",
+			Help:      "Gauge metric with undo bytes per status active/unexpired/expired (dba_undo_extents).",
+		}, []string{"database", "dbinstance", "tablespace", "status"}),
+		undoRetention: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "undo_tuned_retention_seconds",
+			Help:      "Gauge metric with the tuned undo retention (v$undostat).",
+		}, []string{"database", "dbinstance"}),
+		undoMaxQuery: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "undo_max_query_seconds",
+			Help:      "Gauge metric with the longest query in the current undo statistics interval (v$undostat).",
+		}, []string{"database", "dbinstance"}),
+		undoErrors: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "undo_errors",
+			Help:      "Gauge metric with ORA-01555 snapshot too old and ORA-30036 no space errors in the last hour (v$undostat).",
+		}, []string{"database", "dbinstance", "error"}),
+		tempUsed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "temp_used_bytes",
+			Help:      "Gauge metric with bytes of temp segments in use per tablespace (v$tempseg_usage).",
+		}, []string{"database", "dbinstance", "tablespace"}),
+		tempSession: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "temp_session_bytes",
+			Help:      "Gauge metric with bytes of temp segments of the top users per username and sql_id (v$tempseg_usage).",
+		}, []string{"database", "dbinstance", "tablespace", "username", "sql_id"}),
+		blocked: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "blocked_sessions",
+			Help:      "Gauge metric with number of sessions waiting for a blocking session (v$session).",
+		}, []string{"database", "dbinstance"}),
+		blockedWait: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "blocked_wait_seconds_max",
+			Help:      "Gauge metric with the longest wait of a blocked session (v$session).",
+		}, []string{"database", "dbinstance"}),
+		blockingDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "blocking_tree_depth",
+			Help:      "Gauge metric with levels of blocked sessions below a root blocker (v$session).",
+		}, []string{"database", "dbinstance"}),
+		blocking: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "blocking_sessions",
+			Help:      "Gauge metric with number of sessions blocked per blocker username, program and sql_id (v$session).",
+		}, []string{"database", "dbinstance", "username", "program", "sql_id"}),
+		longops: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "longops_running",
+			Help:      "Gauge metric with number of running long operations (v$session_longops).",
+		}, []string{"database", "dbinstance"}),
+		longopsProgress: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "longops_progress_ratio",
+			Help:      "Gauge metric with done work of a long operation, 0 to 1 (v$session_longops).",
+		}, []string{"database", "dbinstance", "sid", "opname", "sql_id"}),
+		longopsRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "longops_remaining_seconds",
+			Help:      "Gauge metric with estimated remaining time of a long operation (v$session_longops).",
+		}, []string{"database", "dbinstance", "sid", "opname", "sql_id"}),
+		sqlElapsed: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_elapsed_seconds_total",
+			Help:      "Counter metric with elapsed time of the top SQL statements (v$sqlstats).",
+		}, []string{"database", "dbinstance", "sql_id", "sql_text", "schema"}),
+		sqlCpu: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_cpu_seconds_total",
+			Help:      "Counter metric with CPU time of the top SQL statements (v$sqlstats).",
+		}, []string{"database", "dbinstance", "sql_id", "sql_text", "schema"}),
+		sqlGets: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_buffer_gets_total",
+			Help:      "Counter metric with buffer gets of the top SQL statements (v$sqlstats).",
+		}, []string{"database", "dbinstance", "sql_id", "sql_text", "schema"}),
+		sqlExecs: newCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_executions_total",
+			Help:      "Counter metric with executions of the top SQL statements (v$sqlstats).",
+		}, []string{"database", "dbinstance", "sql_id", "sql_text", "schema"}),
 		tablerows: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "tablerows",
@@ -204,7 +548,7 @@ func NewExporter() *Exporter {
 			Namespace: namespace,
 			Name:      "tablebytes",
 			Help:      "Gauge metric with bytes of all Tables.",
-		}, []string{"database", "dbinstance", "owner", "table_name"}),
+		}, append([]string{"database", "dbinstance", "owner", "table_name"}, partitionLabels()...)),
 		indexbytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
 			Name:      "indexbytes",
@@ -215,114 +559,24 @@ func NewExporter() *Exporter {
 			Name:      "lobbytes",
 			Help:      "Gauge metric with bytes of all Lobs per Table.",
 		}, []string{"database", "dbinstance", "owner", "table_name"}),
-		custom: make(map[string]*prometheus.GaugeVec),
+		custom:     make(map[string]*customMetric),
+		results:    make(map[string]*queryResult),
+		lastRun:    make(map[string]time.Time),
+		dropped:    make(map[string]bool),
+		sqlStats:   make(map[string]map[string]*sqlStat),
+		sqlScraped: make(map[string]time.Time),
+		started:    time.Now(),
 	}
 	// add custom metrics
 	for _, conn := range config.Cfgs {
-		for _, query := range conn.Queries {
-			labels := []string{}
-			for _, label := range query.Labels {
-				labels = append(labels, cleanName(label))
-			}
-			e.custom[query.Name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: namespace,
-				Name:      "custom_" + cleanName(query.Name),
-				Help:      query.Help,
-			}, append(labels, "metric", "database", "dbinstance", "rownum"))
+		for q := range conn.Queries {
+			e.addCustomMetrics(&conn.Queries[q])
 		}
 	}
 
 	return &e
 }
 
-// ScrapeCustomQueries collects metrics from self defined queries from configuration file.
-func (e *Exporter) ScrapeCustomQueries() {
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	for _, conn := range config.Cfgs {
-		if conn.db != nil {
-			for _, query := range conn.Queries {
-				rows, err = conn.db.Query(query.Sql)
-				if err != nil {
-					continue
-				}
-
-				cols, _ := rows.Columns()
-				vals := make([]interface{}, len(cols))
-
-				defer rows.Close()
-				var rownum int = 1
-
-				for rows.Next() {
-					for i := range cols {
-						vals[i] = &vals[i]
-					}
-
-					err = rows.Scan(vals...)
-					if err != nil {
-						break
-					}
-
-				MetricLoop:
-					for _, metric := range query.Metrics {
-						metricColumnIndex := -1
-						for i, col := range cols {
-							if cleanName(metric) == cleanName(col) {
-								metricColumnIndex = i
-								break
-							}
-						}
-
-						if metricColumnIndex == -1 {
-							//log.Infoln("Metric column '" + metric + "' not found")
-							continue MetricLoop
-						}
-
-						if metricValue, ok := vals[metricColumnIndex].(float64); ok {
-							promLabels := prometheus.Labels{}
-							promLabels["database"] = conn.Database
-							promLabels["dbinstance"] = conn.Instance
-							promLabels["metric"] = metric
-							promLabels["rownum"] = strconv.Itoa(rownum)
-						LebelLoop:
-							for _, label := range query.Labels {
-								labelColumnIndex := -1
-								for i, col := range cols {
-									if cleanName(label) == cleanName(col) {
-										labelColumnIndex = i
-										break
-									}
-								}
-
-								if labelColumnIndex == -1 {
-									//log.Infoln("Label column not found")
-									break LebelLoop
-								}
-
-								if a, ok := vals[labelColumnIndex].(string); ok {
-									promLabels[cleanName(label)] = a
-								} else if b, ok := vals[labelColumnIndex].(float64); ok {
-									// if value is integer
-									if b == float64(int64(b)) {
-										promLabels[cleanName(label)] = strconv.Itoa(int(b))
-									} else {
-										promLabels[cleanName(label)] = strconv.FormatFloat(b, 'e', -1, 64)
-									}
-								}
-							}
-							e.custom[query.Name].With(promLabels).Set(metricValue)
-						}
-					}
-
-					rownum++
-				}
-			}
-		}
-	}
-}
-
 // ScrapeQuery collects metrics from self defined queries from configuration file.
 // func (e *Exporter) ScrapeQuery() {
 // 	var (
@@ -364,30 +618,45 @@ func (e *Exporter) ScrapeCustomQueries() {
 // 	}
 // }
 
-// ScrapeParameters collects metrics from the v$parameters view.
+// ScrapeParameters collects metrics from the v$parameters view. Numeric
+// parameters are exported as gauge, all others as info metric.
 func (e *Exporter) ScrapeParameter() {
 	var (
 		rows *sql.Rows
 		err  error
 	)
+	where, args := nameFilter("name", config.Parameters, defaultParameters)
+	if len(config.Parameters) == 1 && strings.EqualFold(config.Parameters[0], "all") {
+		where, args = "1=1", nil
+	}
 	for _, conn := range config.Cfgs {
-		//num  metric_name
-		//43  sessions
 		if conn.db != nil {
-			rows, err = conn.db.Query(`select name,value from v$parameter WHERE num=43`)
+			//type  1 boolean, 2 string, 3 integer, 4 parameter file, 6 big integer
+			rows, err = conn.db.Query(`select name,type,value,isdefault,ismodified from v$parameter
+                                 where `+where, args...)
 			if err != nil {
 				continue
 			}
-			defer rows.Close()
 			for rows.Next() {
 				var name string
-				var value float64
-				if err := rows.Scan(&name, &value); err != nil {
+				var ptype int
+				var value sql.NullString
+				var isdefault string
+				var ismodified string
+				if err := rows.Scan(&name, &ptype, &value, &isdefault, &ismodified); err != nil {
 					break
 				}
-				name = cleanName(name)
-				e.parameter.WithLabelValues(conn.Database, conn.Instance, name).Set(value)
+				isdefault = strings.ToLower(isdefault)
+				ismodified = strings.ToLower(ismodified)
+				if ptype == 3 || ptype == 6 {
+					if v, ok := toFloat(value.String); ok {
+						e.parameter.WithLabelValues(conn.Database, conn.Instance, cleanName(name), isdefault, ismodified).Set(v)
+						continue
+					}
+				}
+				e.parameterInfo.WithLabelValues(conn.Database, conn.Instance, cleanName(name), value.String, isdefault, ismodified).Set(1)
 			}
+			rows.Close()
 		}
 	}
 }
@@ -417,85 +686,64 @@ func (e *Exporter) ScrapeServices() {
 	}
 }
 
-// ScrapeCache collects session metrics from the v$sysmetrics view.
-func (e *Exporter) ScrapeCache() {
+// ScrapeResource collects the utilization and limits of resources from the v$resource_limit view.
+func (e *Exporter) ScrapeResource() {
 	var (
 		rows *sql.Rows
 		err  error
 	)
 	for _, conn := range config.Cfgs {
-		//metric_id  metric_name
-		//2000    Buffer Cache Hit Ratio
-		//2050    Cursor Cache Hit Ratio
-		//2112    Library Cache Hit Ratio
-		//2110    Row Cache Hit Ratio
 		if conn.db != nil {
-			rows, err = conn.db.Query(`select metric_name,value
-                                 from v$sysmetric
-                                 where group_id=2 and metric_id in (2000,2050,2112,2110)`)
+			rows, err = conn.db.Query(`select resource_name,current_utilization,max_utilization,limit_value
+                                 from v$resource_limit`)
 			if err != nil {
 				continue
 			}
-			defer rows.Close()
 			for rows.Next() {
 				var name string
-				var value float64
-				if err := rows.Scan(&name, &value); err != nil {
+				var current float64
+				var max float64
+				var limit string
+				if err := rows.Scan(&name, &current, &max, &limit); err != nil {
 					break
 				}
 				name = cleanName(name)
-				e.cache.WithLabelValues(conn.Database, conn.Instance, name).Set(value)
-			}
-		}
-	}
-}
-
-// ScrapeRecovery collects tablespace metrics
-func (e *Exporter) ScrapeRedo() {
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	for _, conn := range config.Cfgs {
-		if conn.db != nil {
-			rows, err = conn.db.Query(`select count(*) from v$log_history where first_time > sysdate - 1/24/12`)
-			if err != nil {
-				continue
-			}
-			defer rows.Close()
-			for rows.Next() {
-				var value float64
-				if err := rows.Scan(&value); err != nil {
-					break
+				e.resourceCurrent.WithLabelValues(conn.Database, conn.Instance, name).Set(current)
+				e.resourceMax.WithLabelValues(conn.Database, conn.Instance, name).Set(max)
+				// limit_value is UNLIMITED or a number
+				if value, ok := toFloat(limit); ok {
+					e.resourceLimit.WithLabelValues(conn.Database, conn.Instance, name).Set(value)
 				}
-				e.redo.WithLabelValues(conn.Database, conn.Instance).Set(value)
 			}
+			rows.Close()
 		}
 	}
 }
 
-// ScrapeRecovery collects tablespace metrics
-func (e *Exporter) ScrapeRecovery() {
+// ScrapeCache collects session metrics from the v$sysmetrics view.
+func (e *Exporter) ScrapeCache() {
 	var (
 		rows *sql.Rows
 		err  error
 	)
+	filter, args := nameFilter("metric_name", config.Statistics.Cache, defaultCache)
 	for _, conn := range config.Cfgs {
 		if conn.db != nil {
-			rows, err = conn.db.Query(`SELECT sum(percent_space_used) , sum(percent_space_reclaimable)
-                                 from V$FLASH_RECOVERY_AREA_USAGE`)
+			rows, err = conn.db.Query(`select metric_name,value
+                                 from v$sysmetric
+                                 where group_id=2 and `+filter, args...)
 			if err != nil {
 				continue
 			}
 			defer rows.Close()
 			for rows.Next() {
-				var used float64
-				var recl float64
-				if err := rows.Scan(&used, &recl); err != nil {
+				var name string
+				var value float64
+				if err := rows.Scan(&name, &value); err != nil {
 					break
 				}
-				e.recovery.WithLabelValues(conn.Database, conn.Instance, "percent_space_used").Set(used)
-				e.recovery.WithLabelValues(conn.Database, conn.Instance, "percent_space_reclaimable").Set(recl)
+				name = cleanName(name)
+				e.cache.WithLabelValues(conn.Database, conn.Instance, name).Set(value)
 			}
 		}
 	}
@@ -563,13 +811,11 @@ func (e *Exporter) ScrapeAsmspace() {
 
 // ScrapeTablespaces collects tablespace metrics
 func (e *Exporter) ScrapeTablespace() {
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	for _, conn := range config.Cfgs {
-		if conn.db != nil {
-			rows, err = conn.db.Query(`WITH
+	for i := range config.Cfgs {
+		conn := &config.Cfgs[i]
+		if conn.ready(stateOpen) {
+			forEachContainer(conn, func(db queryer, pdb container) {
+				rows, err := db.QueryContext(context.Background(), `WITH
                                    getsize AS (SELECT tablespace_name, max(autoextensible) autoextensible, SUM(bytes) tsize, sum(maxbytes) maxbytes
                                                FROM dba_data_files GROUP BY tablespace_name),
                                    getfree as (SELECT tablespace_name, contents, SUM(blocks*block_size) tfree
@@ -583,53 +829,61 @@ func (e *Exporter) ScrapeTablespace() {
                                  SELECT tablespace_name, 'TEMPORARY', sum(tablespace_size), sum(tablespace_size), sum(free_space), 'NO'
                                  FROM dba_temp_free_space
                                  GROUP BY tablespace_name`)
-			if err != nil {
-				continue
-			}
-			defer rows.Close()
-			for rows.Next() {
-				var name string
-				var contents string
-				var tsize float64
-				var maxsize float64
-				var tfree float64
-				var auto string
-				if err := rows.Scan(&name, &contents, &tsize, &maxsize, &tfree, &auto); err != nil {
-					break
+				if err != nil {
+					return
 				}
-				e.tablespace.WithLabelValues(conn.Database, conn.Instance, "total", name, contents, auto).Set(tsize)
-				e.tablespace.WithLabelValues(conn.Database, conn.Instance, "max", name, contents, auto).Set(maxsize)
-				e.tablespace.WithLabelValues(conn.Database, conn.Instance, "free", name, contents, auto).Set(tfree)
-				e.tablespace.WithLabelValues(conn.Database, conn.Instance, "used", name, contents, auto).Set(tsize - tfree)
-			}
+				defer rows.Close()
+				for rows.Next() {
+					var name string
+					var contents string
+					var tsize float64
+					var maxsize float64
+					var tfree float64
+					var auto string
+					if err := rows.Scan(&name, &contents, &tsize, &maxsize, &tfree, &auto); err != nil {
+						break
+					}
+					labels := func(t string) []string {
+						return append([]string{conn.Database, conn.Instance, t, name, contents, auto}, pdb.labels()...)
+					}
+					e.tablespace.WithLabelValues(labels("total")...).Set(tsize)
+					e.tablespace.WithLabelValues(labels("max")...).Set(maxsize)
+					e.tablespace.WithLabelValues(labels("free")...).Set(tfree)
+					e.tablespace.WithLabelValues(labels("used")...).Set(tsize - tfree)
+				}
+			})
 		}
 	}
 }
 
 // ScrapeSessions collects session metrics from the v$session view.
 func (e *Exporter) ScrapeSession() {
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	for _, conn := range config.Cfgs {
+	for i := range config.Cfgs {
+		conn := &config.Cfgs[i]
 		if conn.db != nil {
-			rows, err = conn.db.Query(`SELECT decode(username,NULL,'SYSTEM','SYS','SYSTEM','USER'), status,count(*)
-                                 FROM v$session
+			forEachContainer(conn, func(db queryer, pdb container) {
+				// In the CDB root v$session shows the sessions of all containers.
+				filter := ""
+				if pdb.conID == "1" {
+					filter = "WHERE con_id IN (0,1)"
+				}
+				rows, err := db.QueryContext(context.Background(), `SELECT decode(username,NULL,'SYSTEM','SYS','SYSTEM','USER'), status,count(*)
+                                 FROM v$session `+filter+`
                                  GROUP BY decode(username,NULL,'SYSTEM','SYS','SYSTEM','USER'),status`)
-			if err != nil {
-				continue
-			}
-			defer rows.Close()
-			for rows.Next() {
-				var user string
-				var status string
-				var value float64
-				if err := rows.Scan(&user, &status, &value); err != nil {
-					break
+				if err != nil {
+					return
 				}
-				e.session.WithLabelValues(conn.Database, conn.Instance, user, status).Set(value)
-			}
+				defer rows.Close()
+				for rows.Next() {
+					var user string
+					var status string
+					var value float64
+					if err := rows.Scan(&user, &status, &value); err != nil {
+						break
+					}
+					e.session.WithLabelValues(append([]string{conn.Database, conn.Instance, user, status}, pdb.labels()...)...).Set(value)
+				}
+			})
 		}
 	}
 }
@@ -654,10 +908,14 @@ func (e *Exporter) ScrapeSysstat() {
 		rows *sql.Rows
 		err  error
 	)
+	filter, args := nameFilter("name", config.Statistics.Sysstat, defaultSysstat)
+	if len(config.Statistics.Sysstat) == 1 && strings.EqualFold(config.Statistics.Sysstat[0], "all") {
+		filter, args = "1=1", nil
+	}
 	for _, conn := range config.Cfgs {
 		if conn.db != nil {
 			rows, err = conn.db.Query(`SELECT name, value FROM v$sysstat
-                                    WHERE statistic# in (6,7,1084,1089)`)
+                                    WHERE `+filter, args...)
 			if err != nil {
 				continue
 			}
@@ -669,7 +927,7 @@ func (e *Exporter) ScrapeSysstat() {
 					break
 				}
 				name = cleanName(name)
-				e.sysstat.WithLabelValues(conn.Database, conn.Instance, name).Set(value)
+				e.sysstat.Set(value, conn.Database, conn.Instance, name)
 			}
 		}
 	}
@@ -709,14 +967,11 @@ func (e *Exporter) ScrapeSysmetric() {
 		rows *sql.Rows
 		err  error
 	)
+	filter, args := nameFilter("metric_name", config.Statistics.Sysmetric, defaultSysmetric)
 	for _, conn := range config.Cfgs {
-		//metric_id  metric_name
-		//2092    Physical Read Total IO Requests Per Sec
-		//2093    Physical Read Total Bytes Per Sec
-		//2100    Physical Write Total IO Requests Per Sec
-		//2124    Physical Write Total Bytes Per Sec
 		if conn.db != nil {
-			rows, err = conn.db.Query("select metric_name,value from v$sysmetric where metric_id in (2092,2093,2124,2100)")
+			rows, err = conn.db.Query(`select metric_name,value from v$sysmetric
+                                 where group_id=2 and `+filter, args...)
 			if err != nil {
 				continue
 			}
@@ -741,7 +996,7 @@ func (e *Exporter) ScrapeTablerows() {
 		err  error
 	)
 	for _, conn := range config.Cfgs {
-		if conn.db != nil {
+		if conn.ready(stateOpen) {
 			rows, err = conn.db.Query(`select owner,table_name, tablespace_name, num_rows
                                  from dba_tables
                                  where owner not like '%SYS%' and num_rows is not null`)
@@ -764,126 +1019,84 @@ func (e *Exporter) ScrapeTablerows() {
 	}
 }
 
-func (e *Exporter) ScrapeTablebytes() {
-	// ScrapeTablebytes collects bytes from dba_tables/dba_segments view.
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	for _, conn := range config.Cfgs {
-		if conn.db != nil {
-			rows, err = conn.db.Query(`SELECT tab.owner, tab.table_name,  stab.bytes
-                                 FROM dba_tables  tab, dba_segments stab
-                                 WHERE stab.owner = tab.owner AND stab.segment_name = tab.table_name
-                                 AND tab.owner NOT LIKE '%SYS%'`)
-			if err != nil {
-				continue
-			}
-			defer rows.Close()
-			for rows.Next() {
-				var owner string
-				var name string
-				var value float64
-				if err = rows.Scan(&owner, &name, &value); err != nil {
-					break
-				}
-				name = cleanName(name)
-				e.tablebytes.WithLabelValues(conn.Database, conn.Instance, owner, name).Set(value)
-			}
-		}
-	}
-}
-
-// ScrapeTablebytes collects bytes from dba_indexes/dba_segments view.
-func (e *Exporter) ScrapeIndexbytes() {
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	for _, conn := range config.Cfgs {
-		if conn.db != nil {
-			rows, err = conn.db.Query(`select table_owner,table_name, sum(bytes)
-                                 from dba_indexes ind, dba_segments seg
-                                 WHERE ind.owner=seg.owner and ind.index_name=seg.segment_name
-                                 and table_owner NOT LIKE '%SYS%'
-                                 group by table_owner,table_name`)
-			if err != nil {
-				continue
-			}
-			defer rows.Close()
-			for rows.Next() {
-				var owner string
-				var name string
-				var value float64
-				if err = rows.Scan(&owner, &name, &value); err != nil {
-					break
-				}
-				name = cleanName(name)
-				e.indexbytes.WithLabelValues(conn.Database, conn.Instance, owner, name).Set(value)
-			}
-		}
-	}
-}
-
-// ScrapeLobbytes collects bytes from dba_lobs/dba_segments view.
-func (e *Exporter) ScrapeLobbytes() {
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	for _, conn := range config.Cfgs {
-		if conn.db != nil {
-			rows, err = conn.db.Query(`select l.owner, l.table_name, sum(bytes)
-                                 from dba_lobs l, dba_segments seg
-                                 WHERE l.owner=seg.owner and l.table_name=seg.segment_name
-                                 and l.owner NOT LIKE '%SYS%'
-                                 group by l.owner,l.table_name`)
-			if err != nil {
-				continue
-			}
-			defer rows.Close()
-			for rows.Next() {
-				var owner string
-				var name string
-				var value float64
-				if err = rows.Scan(&owner, &name, &value); err != nil {
-					break
-				}
-				name = cleanName(name)
-				e.lobbytes.WithLabelValues(conn.Database, conn.Instance, owner, name).Set(value)
-			}
-		}
-	}
-}
-
 // Describe describes all the metrics exported by the Oracle exporter.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	e.duration.Describe(ch)
 	e.totalScrapes.Describe(ch)
 	e.scrapeErrors.Describe(ch)
+	e.droppedValues.Describe(ch)
 	e.session.Describe(ch)
 	e.sysstat.Describe(ch)
 	e.waitclass.Describe(ch)
 	e.sysmetric.Describe(ch)
 	e.interconnect.Describe(ch)
 	e.tablespace.Describe(ch)
-	e.recovery.Describe(ch)
+	e.datafile.Describe(ch)
+	e.datafileInfo.Describe(ch)
+	e.tsUsable.Describe(ch)
+	e.tsUsed.Describe(ch)
+	e.recoveryUsed.Describe(ch)
+	e.recoveryRecl.Describe(ch)
+	e.recoveryDest.Describe(ch)
+	e.archivelogBytes.Describe(ch)
 	e.redo.Describe(ch)
+	e.redoSwitches.Describe(ch)
+	e.redoBytes.Describe(ch)
+	e.redoLog.Describe(ch)
+	e.redoLogfile.Describe(ch)
+	e.redoActive.Describe(ch)
+	e.redoWaits.Describe(ch)
+	e.redoWaitTime.Describe(ch)
 	e.cache.Describe(ch)
 	e.uptime.Describe(ch)
 	e.up.Describe(ch)
+	e.instance.Describe(ch)
 	e.alertlog.Describe(ch)
 	e.alertdate.Describe(ch)
 	e.services.Describe(ch)
+	e.resourceCurrent.Describe(ch)
+	e.resourceMax.Describe(ch)
+	e.resourceLimit.Describe(ch)
 	e.parameter.Describe(ch)
+	e.parameterInfo.Describe(ch)
+	e.configDrift.Describe(ch)
 	//e.query.Describe(ch)
 	e.asmspace.Describe(ch)
+	e.dataguard.Describe(ch)
+	e.dataguardLag.Describe(ch)
+	e.dataguardProcess.Describe(ch)
+	e.archiveDest.Describe(ch)
+	e.rmanBackup.Describe(ch)
+	e.rmanJobs.Describe(ch)
+	e.rmanDuration.Describe(ch)
+	e.rmanBytes.Describe(ch)
+	e.rmanPieces.Describe(ch)
+	e.waitevents.Describe(ch)
+	e.waiteventTime.Describe(ch)
+	e.ash.Describe(ch)
+	e.undoBytes.Describe(ch)
+	e.undoRetention.Describe(ch)
+	e.undoMaxQuery.Describe(ch)
+	e.undoErrors.Describe(ch)
+	e.tempUsed.Describe(ch)
+	e.tempSession.Describe(ch)
+	e.blocked.Describe(ch)
+	e.blockedWait.Describe(ch)
+	e.blockingDepth.Describe(ch)
+	e.blocking.Describe(ch)
+	e.longops.Describe(ch)
+	e.longopsProgress.Describe(ch)
+	e.longopsRemaining.Describe(ch)
+	e.sqlElapsed.Describe(ch)
+	e.sqlCpu.Describe(ch)
+	e.sqlGets.Describe(ch)
+	e.sqlExecs.Describe(ch)
 	e.tablerows.Describe(ch)
 	e.tablebytes.Describe(ch)
 	e.indexbytes.Describe(ch)
 	e.lobbytes.Describe(ch)
 	for _, metric := range e.custom {
-		metric.Describe(ch)
+		ch <- metric.desc
 	}
 }
 
@@ -891,26 +1104,61 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 func (e *Exporter) Connect() {
 	var dbname string
 	var inname string
+	var version string
+	var status string
+	var logins string
+	var role string
+	var mode string
 	var err error
 
+	e.instance.Reset()
 	for i, conf := range config.Cfgs {
 		// Close Connect from former scrape that not closed properly
 		if config.Cfgs[i].db != nil {
 			config.Cfgs[i].db.Close()
 			config.Cfgs[i].db = nil
 		}
+		config.Cfgs[i].status = ""
+		config.Cfgs[i].pdbs = nil
 		if len(conf.Connection) > 0 {
 			config.Cfgs[i].db, err = sql.Open("oci8", conf.Connection)
 			if err == nil {
-				err = config.Cfgs[i].db.QueryRow("select db_unique_name,instance_name from v$database,v$instance").Scan(&dbname, &inname)
+				err = config.Cfgs[i].db.QueryRow("select instance_name,status,version,logins from v$instance").Scan(&inname, &status, &version, &logins)
 				if err == nil {
+					// Since 18c version is always X.0.0.0.0, the release update is in version_full
+					if compareVersion(version, "18") >= 0 {
+						var full string
+						if config.Cfgs[i].db.QueryRow("select version_full from v$instance").Scan(&full) == nil {
+							version = full
+						}
+					}
+					// v$database can't be queried on ASM and NOMOUNT instances
+					err = config.Cfgs[i].db.QueryRow("select db_unique_name,database_role,open_mode from v$database").Scan(&dbname, &role, &mode)
+					if err != nil {
+						dbname = inname
+						role = ""
+						mode = ""
+					}
+					config.Cfgs[i].version = version
+					config.Cfgs[i].status = status
+					config.Cfgs[i].role = role
+					// The PDBs are listed once per scrape for all collectors.
+					if conf.Pdbs.enabled() {
+						pdbs, err := containers(&config.Cfgs[i])
+						if err != nil {
+							log.Errorln("Error listing PDBs of", inname+":", err)
+						}
+						config.Cfgs[i].pdbs = pdbs
+					}
 					if (len(conf.Database) == 0) || (len(conf.Instance) == 0) {
 						config.Cfgs[i].Database = dbname
 						config.Cfgs[i].Instance = inname
 					}
 					e.up.WithLabelValues(conf.Database, conf.Instance).Set(1)
+					e.instance.WithLabelValues(config.Cfgs[i].Database, config.Cfgs[i].Instance, status, mode, role, logins, version).Set(1)
 				} else {
 					config.Cfgs[i].db.Close()
+					config.Cfgs[i].db = nil
 					e.up.WithLabelValues(conf.Database, conf.Instance).Set(0)
 					log.Errorln("Error connecting to database:", err)
 					//log.Infoln("Connect OK, Inital query failed: ", conf.Connection)
@@ -927,24 +1175,69 @@ func (e *Exporter) Connect() {
 	e.sysmetric.Reset()
 	e.interconnect.Reset()
 	e.tablespace.Reset()
-	e.recovery.Reset()
+	e.datafile.Reset()
+	e.datafileInfo.Reset()
+	e.tsUsable.Reset()
+	e.tsUsed.Reset()
+	e.recoveryUsed.Reset()
+	e.recoveryRecl.Reset()
+	e.recoveryDest.Reset()
+	e.archivelogBytes.Reset()
 	e.redo.Reset()
+	e.redoSwitches.Reset()
+	e.redoBytes.Reset()
+	e.redoLog.Reset()
+	e.redoLogfile.Reset()
+	e.redoActive.Reset()
+	e.redoWaits.Reset()
+	e.redoWaitTime.Reset()
 	e.cache.Reset()
 	e.uptime.Reset()
 	e.alertlog.Reset()
 	e.alertdate.Reset()
 	e.services.Reset()
+	e.resourceCurrent.Reset()
+	e.resourceMax.Reset()
+	e.resourceLimit.Reset()
 	e.parameter.Reset()
+	e.parameterInfo.Reset()
+	e.configDrift.Reset()
 	//e.query.Reset()
 	e.asmspace.Reset()
+	e.dataguard.Reset()
+	e.dataguardLag.Reset()
+	e.dataguardProcess.Reset()
+	e.archiveDest.Reset()
+	e.rmanBackup.Reset()
+	e.rmanJobs.Reset()
+	e.rmanDuration.Reset()
+	e.rmanBytes.Reset()
+	e.rmanPieces.Reset()
+	e.waitevents.Reset()
+	e.waiteventTime.Reset()
+	e.ash.Reset()
+	e.undoBytes.Reset()
+	e.undoRetention.Reset()
+	e.undoMaxQuery.Reset()
+	e.undoErrors.Reset()
+	e.tempUsed.Reset()
+	e.tempSession.Reset()
+	e.blocked.Reset()
+	e.blockedWait.Reset()
+	e.blockingDepth.Reset()
+	e.blocking.Reset()
+	e.longops.Reset()
+	e.longopsProgress.Reset()
+	e.longopsRemaining.Reset()
+	e.sqlElapsed.Reset()
+	e.sqlCpu.Reset()
+	e.sqlGets.Reset()
+	e.sqlExecs.Reset()
 	e.tablerows.Reset()
 	e.tablebytes.Reset()
 	e.indexbytes.Reset()
 	e.lobbytes.Reset()
-
-	for _, metric := range e.custom {
-		metric.Reset()
-	}
+	e.customVals = nil
 }
 
 // Close Connections
@@ -961,6 +1254,9 @@ func (e *Exporter) Close() {
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	var err error
 
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.totalScrapes.Inc()
 	defer func(begun time.Time) {
 		e.duration.Set(time.Since(begun).Seconds())
@@ -973,10 +1269,71 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 
 	e.Connect()
 	e.up.Collect(ch)
+	e.instance.Collect(ch)
+
+	if e.vDatafiles || *pDatafiles {
+		e.ScrapeDatafiles()
+		e.datafile.Collect(ch)
+		e.datafileInfo.Collect(ch)
+		e.tsUsable.Collect(ch)
+		e.tsUsed.Collect(ch)
+	}
 
 	if e.vRecovery || *pRecovery {
 		e.ScrapeRecovery()
-		e.recovery.Collect(ch)
+		e.recoveryUsed.Collect(ch)
+		e.recoveryRecl.Collect(ch)
+		e.recoveryDest.Collect(ch)
+		e.archivelogBytes.Collect(ch)
+	}
+
+	if e.vRman || *pRman {
+		e.ScrapeRman()
+		e.rmanBackup.Collect(ch)
+		e.rmanJobs.Collect(ch)
+		e.rmanDuration.Collect(ch)
+		e.rmanBytes.Collect(ch)
+		e.rmanPieces.Collect(ch)
+	}
+
+	if e.vWaitevents || *pWaitevents {
+		e.ScrapeWaitevents()
+		e.waitevents.Collect(ch)
+		e.waiteventTime.Collect(ch)
+	}
+
+	if *pAsh {
+		e.ScrapeAsh()
+		e.ash.Collect(ch)
+	}
+
+	if e.vUndo || *pUndo {
+		e.ScrapeUndo()
+		e.undoBytes.Collect(ch)
+		e.undoRetention.Collect(ch)
+		e.undoMaxQuery.Collect(ch)
+		e.undoErrors.Collect(ch)
+		e.tempUsed.Collect(ch)
+		e.tempSession.Collect(ch)
+	}
+
+	if e.vBlocking || *pBlocking {
+		e.ScrapeBlocking()
+		e.blocked.Collect(ch)
+		e.blockedWait.Collect(ch)
+		e.blockingDepth.Collect(ch)
+		e.blocking.Collect(ch)
+		e.longops.Collect(ch)
+		e.longopsProgress.Collect(ch)
+		e.longopsRemaining.Collect(ch)
+	}
+
+	if e.vTopsql || *pTopsql {
+		e.ScrapeTopsql()
+		e.sqlElapsed.Collect(ch)
+		e.sqlCpu.Collect(ch)
+		e.sqlGets.Collect(ch)
+		e.sqlExecs.Collect(ch)
 	}
 
 	if *pMetrics {
@@ -1003,6 +1360,13 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 
 		e.ScrapeRedo()
 		e.redo.Collect(ch)
+		e.redoSwitches.Collect(ch)
+		e.redoBytes.Collect(ch)
+		e.redoLog.Collect(ch)
+		e.redoLogfile.Collect(ch)
+		e.redoActive.Collect(ch)
+		e.redoWaits.Collect(ch)
+		e.redoWaitTime.Collect(ch)
 
 		e.ScrapeCache()
 		e.cache.Collect(ch)
@@ -1014,16 +1378,33 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 		e.ScrapeServices()
 		e.services.Collect(ch)
 
+		e.ScrapeResource()
+		e.resourceCurrent.Collect(ch)
+		e.resourceMax.Collect(ch)
+		e.resourceLimit.Collect(ch)
+
 		e.ScrapeParameter()
 		e.parameter.Collect(ch)
+		e.parameterInfo.Collect(ch)
+
+		if len(baseline.Groups) > 0 {
+			e.ScrapeDrift()
+			e.configDrift.Collect(ch)
+		}
 
 		e.ScrapeAsmspace()
 		e.asmspace.Collect(ch)
+
+		e.ScrapeDataguard()
+		e.dataguard.Collect(ch)
+		e.dataguardLag.Collect(ch)
+		e.dataguardProcess.Collect(ch)
+		e.archiveDest.Collect(ch)
 	}
 
 	e.ScrapeCustomQueries()
-	for _, metric := range e.custom {
-		metric.Collect(ch)
+	for _, metric := range e.customVals {
+		ch <- metric
 	}
 	//e.ScrapeQuery()
 	//e.query.Collect(ch)
@@ -1033,18 +1414,13 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 		e.tablerows.Collect(ch)
 	}
 
-	if e.vTabBytes || *pTabBytes {
-		e.ScrapeTablebytes()
+	tables := e.vTabBytes || *pTabBytes
+	indexes := e.vIndBytes || *pIndBytes
+	lobs := e.vLobBytes || *pLobBytes
+	if tables || indexes || lobs {
+		e.ScrapeSegments(tables, indexes, lobs)
 		e.tablebytes.Collect(ch)
-	}
-
-	if e.vIndBytes || *pIndBytes {
-		e.ScrapeIndexbytes()
 		e.indexbytes.Collect(ch)
-	}
-
-	if e.vLobBytes || *pLobBytes {
-		e.ScrapeLobbytes()
 		e.lobbytes.Collect(ch)
 	}
 
@@ -1052,6 +1428,7 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	ch <- e.totalScrapes
 	ch <- e.error
 	e.scrapeErrors.Collect(ch)
+	e.droppedValues.Collect(ch)
 
 	e.Close()
 }
@@ -1067,6 +1444,12 @@ func (e *Exporter) Handler(w http.ResponseWriter, r *http.Request) {
 	e.vIndBytes = false
 	e.vLobBytes = false
 	e.vRecovery = false
+	e.vRman = false
+	e.vWaitevents = false
+	e.vTopsql = false
+	e.vBlocking = false
+	e.vUndo = false
+	e.vDatafiles = false
 	if r.URL.Query().Get("tablerows") == "true" {
 		e.vTabRows = true
 	}
@@ -1082,6 +1465,24 @@ func (e *Exporter) Handler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Query().Get("recovery") == "true" {
 		e.vRecovery = true
 	}
+	if r.URL.Query().Get("rman") == "true" {
+		e.vRman = true
+	}
+	if r.URL.Query().Get("waitevents") == "true" {
+		e.vWaitevents = true
+	}
+	if r.URL.Query().Get("topsql") == "true" {
+		e.vTopsql = true
+	}
+	if r.URL.Query().Get("blocking") == "true" {
+		e.vBlocking = true
+	}
+	if r.URL.Query().Get("undo") == "true" {
+		e.vUndo = true
+	}
+	if r.URL.Query().Get("datafiles") == "true" {
+		e.vDatafiles = true
+	}
 	promhttp.Handler().ServeHTTP(w, r)
 }
 
@@ -1091,6 +1492,10 @@ func main() {
 	if loadConfig() {
 		log.Infoln("Config loaded: ", *configFile)
 		exporter := NewExporter()
+		if *pDriftReport {
+			exporter.Connect()
+			os.Exit(driftReport())
+		}
 		prometheus.MustRegister(exporter)
 
 		http.HandleFunc(*metricPath, exporter.Handler)
@@ -2,13 +2,17 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/mattn/go-oci8"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
 	"gopkg.in/yaml.v2"
 )
@@ -18,25 +22,138 @@ type Alert struct {
 	Ignoreora []string `yaml:"ignoreora"`
 }
 
+// Instances restricts a query to (or excludes it from) instance or database names.
+type Instances struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Column describes how a metric column of a custom query is exported.
+// Buckets maps the upper bound of a histogram bucket to the column holding
+// its cumulative count.
+type Column struct {
+	Help    string            `yaml:"help"`
+	Type    string            `yaml:"type"`
+	Unit    string            `yaml:"unit"`
+	Scale   float64           `yaml:"scale"`
+	Buckets map[string]string `yaml:"buckets"`
+	Count   string            `yaml:"count"`
+}
+
 type Query struct {
-	Sql     string   `yaml:"sql"`
-	Name    string   `yaml:"name"`
-	Metrics []string `yaml:"metrics"`
-	Labels  []string `yaml:"labels"`
-	Help    string   `yaml:"help"`
+	Sql          string            `yaml:"sql"`
+	Name         string            `yaml:"name"`
+	Metrics      []string          `yaml:"metrics"`
+	Labels       []string          `yaml:"labels"`
+	Help         string            `yaml:"help"`
+	Timeout      time.Duration     `yaml:"timeout"`
+	Interval     time.Duration     `yaml:"interval"`
+	MinVersion   string            `yaml:"min_version"`
+	MaxVersion   string            `yaml:"max_version"`
+	DatabaseRole string            `yaml:"database_role"`
+	Instances    Instances         `yaml:"instances"`
+	Columns      map[string]Column `yaml:"columns"`
+	PerColumn    bool              `yaml:"per_column"`
+	Prefix       string            `yaml:"prefix"`
+	Duplicates   string            `yaml:"duplicates"`
+	NullValue    string            `yaml:"null_value"`
+	Container    string            `yaml:"container"`
+	Requires     string            `yaml:"requires"`
+	KeyColumn    string            `yaml:"key_column"`
+	ValueColumn  string            `yaml:"value_column"`
+	IncludeKeys  string            `yaml:"include_keys"`
+	ExcludeKeys  string            `yaml:"exclude_keys"`
+	includeKeys  *regexp.Regexp
+	excludeKeys  *regexp.Regexp
 }
 
 type Config struct {
-	Connection string  `yaml:"connection"`
-	Database   string  `yaml:"database"`
-	Instance   string  `yaml:"instance"`
-	Alertlog   []Alert `yaml:"alertlog"`
-	Queries    []Query `yaml:"queries"`
+	Connection string            `yaml:"connection"`
+	Database   string            `yaml:"database"`
+	Instance   string            `yaml:"instance"`
+	Alertlog   []Alert           `yaml:"alertlog"`
+	MetricSets []string          `yaml:"metric_sets"`
+	Vars       map[string]string `yaml:"vars"`
+	Pdbs       Pdbs              `yaml:"pdbs"`
+	Queries    []Query           `yaml:"queries"`
 	db         *sql.DB
+	version    string
+	status     string
+	role       string
+	pdbs       []container
+}
+
+// Instance states a collector can require, see Config.ready.
+const (
+	stateStarted = iota
+	stateMounted
+	stateOpen
+)
+
+// ready reports whether the instance of a connection is up and at least in
+// the given state. ASM and NOMOUNT instances are only started.
+func (c *Config) ready(state int) bool {
+	if c.db == nil {
+		return false
+	}
+	open := strings.HasPrefix(c.status, "OPEN")
+	switch state {
+	case stateOpen:
+		return open
+	case stateMounted:
+		return open || c.status == "MOUNTED"
+	}
+	return true
 }
 
 type Configs struct {
-	Cfgs []Config `yaml:"connections"`
+	Namespace  string             `yaml:"namespace"`
+	Prefix     string             `yaml:"prefix"`
+	QueryFiles []string           `yaml:"query_files"`
+	MetricSets map[string][]Query `yaml:"metric_sets"`
+	TopSql     TopSql             `yaml:"topsql"`
+	Statistics Statistics         `yaml:"statistics"`
+	Parameters []string           `yaml:"parameters"`
+	Baseline   string             `yaml:"baseline"`
+	Segments   Segments           `yaml:"segments"`
+	Cfgs       []Config           `yaml:"connections"`
+}
+
+// Statistics selects the v$sysstat statistics and v$sysmetric metrics of the
+// sysstat, sysmetric and cachehitratio collectors by name. An empty list
+// keeps the default, sysstat can be "all".
+type Statistics struct {
+	Sysstat   []string `yaml:"sysstat"`
+	Sysmetric []string `yaml:"sysmetric"`
+	Cache     []string `yaml:"cachehitratio"`
+}
+
+var (
+	defaultSysstat   = []string{"parse count (total)", "execute count", "user commits", "user rollbacks"}
+	defaultSysmetric = []string{"Physical Read Total IO Requests Per Sec", "Physical Read Total Bytes Per Sec",
+		"Physical Write Total IO Requests Per Sec", "Physical Write Total Bytes Per Sec"}
+	defaultParameters = []string{"sessions"}
+	defaultCache      = []string{"Buffer Cache Hit Ratio", "Cursor Cache Hit Ratio", "Library Cache Hit Ratio", "Row Cache Hit Ratio"}
+)
+
+// nameFilter returns a case insensitive IN condition on column with one bind
+// per name, or the defaults if names is empty.
+func nameFilter(column string, names []string, defaults []string) (string, []interface{}) {
+	if len(names) == 0 {
+		names = defaults
+	}
+	binds := make([]string, len(names))
+	args := make([]interface{}, len(names))
+	for i, n := range names {
+		binds[i] = ":" + strconv.Itoa(i+1)
+		args[i] = strings.ToLower(n)
+	}
+	return "lower(" + column + ") IN (" + strings.Join(binds, ",") + ")", args
+}
+
+// QueryFile is a shared query library referenced by query_files.
+type QueryFile struct {
+	MetricSets map[string][]Query `yaml:"metric_sets"`
 }
 
 var (
@@ -44,6 +161,44 @@ var (
 	pwd    string
 )
 
+// constVec is a vector of constant metrics. Unlike CounterVec the value of
+// a counter can be set, which is needed for cumulative values read from Oracle.
+type constVec struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	metrics   []prometheus.Metric
+}
+
+func newCounterVec(opts prometheus.CounterOpts, labels []string) *constVec {
+	return &constVec{
+		desc:      prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), opts.Help, labels, nil),
+		valueType: prometheus.CounterValue,
+	}
+}
+
+func (v *constVec) Set(value float64, labels ...string) {
+	m, err := prometheus.NewConstMetric(v.desc, v.valueType, value, labels...)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	v.metrics = append(v.metrics, m)
+}
+
+func (v *constVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+func (v *constVec) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range v.metrics {
+		ch <- m
+	}
+}
+
+func (v *constVec) Reset() {
+	v.metrics = nil
+}
+
 // Oracle gives us some ugly names back. This function cleans things up for Prometheus.
 func cleanName(s string) string {
 	s = strings.Replace(s, " ", "_", -1) // Remove spaces
@@ -54,12 +209,64 @@ func cleanName(s string) string {
 	return s
 }
 
+// toFloat converts a value returned by the driver into a float64. Dates and
+// timestamps become Unix seconds, intervals seconds. NULL is not converted.
+func toFloat(v interface{}) (float64, bool) {
+	switch a := v.(type) {
+	case float64:
+		return a, true
+	case float32:
+		return float64(a), true
+	case int64:
+		return float64(a), true
+	case int:
+		return float64(a), true
+	case bool:
+		if a {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(a)), 64)
+		return f, err == nil
+	case time.Time:
+		return float64(a.UnixNano()) / 1e9, true
+	case time.Duration:
+		return a.Seconds(), true
+	}
+	return 0, false
+}
+
 func cleanIp(s string) string {
 	s = strings.Replace(s, ":", "", -1)  // Remove spaces
 	s = strings.Replace(s, ".", "_", -1) // Remove open parenthesis
 	return s
 }
 
+// compareVersion compares an Oracle version like 19.0.0.0.0 with a (possibly
+// shorter) bound like 12.2. Only as many components as the bound has are compared.
+func compareVersion(version string, bound string) int {
+	v := strings.Split(version, ".")
+	b := strings.Split(bound, ".")
+	for i := range b {
+		var vn, bn int
+		if i < len(v) {
+			vn, _ = strconv.Atoi(strings.TrimSpace(v[i]))
+		}
+		bn, _ = strconv.Atoi(strings.TrimSpace(b[i]))
+		if vn < bn {
+			return -1
+		}
+		if vn > bn {
+			return 1
+		}
+	}
+	return 0
+}
+
 func loadConfig() bool {
 	path, err := filepath.Abs(filepath.Dir(os.Args[0]))
 	if err != nil {
@@ -76,10 +283,158 @@ func loadConfig() bool {
 			log.Fatalf("error: %v", err)
 			return false
 		}
+		if err := loadQueryFiles(); err != nil {
+			log.Fatalf("error: %v", err)
+			return false
+		}
+		if err := resolveQueries(); err != nil {
+			log.Fatalf("error: %v", err)
+			return false
+		}
+		if err := loadBaseline(); err != nil {
+			log.Fatalf("error: %v", err)
+			return false
+		}
 		return true
 	}
 }
 
+// loadQueryFiles reads the metric sets of all query_files into the config.
+// Relative paths are taken from the directory of the config file.
+func loadQueryFiles() error {
+	if config.MetricSets == nil {
+		config.MetricSets = make(map[string][]Query)
+	}
+	for _, file := range config.QueryFiles {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(*configFile), file)
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var qf QueryFile
+		if err := yaml.Unmarshal(content, &qf); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		for name, queries := range qf.MetricSets {
+			if _, ok := config.MetricSets[name]; ok {
+				return fmt.Errorf("%s: metric set %s is already defined", file, name)
+			}
+			config.MetricSets[name] = queries
+		}
+	}
+	return nil
+}
+
+// resolveQueries builds the query list of every connection from the metric
+// sets it refers to. Queries of the connection with the same name as a query
+// of a set override the fields they set.
+func resolveQueries() error {
+	for i := range config.Cfgs {
+		conn := &config.Cfgs[i]
+		var queries []Query
+		for _, set := range conn.MetricSets {
+			qs, ok := config.MetricSets[set]
+			if !ok {
+				return fmt.Errorf("connection %s: unknown metric set %s", conn.Instance, set)
+			}
+			for _, q := range qs {
+				if queryIndex(queries, q.Name) >= 0 {
+					return fmt.Errorf("connection %s: query %s defined in more than one metric set", conn.Instance, q.Name)
+				}
+				queries = append(queries, q)
+			}
+		}
+		for _, q := range conn.Queries {
+			if n := queryIndex(queries, q.Name); n >= 0 {
+				queries[n] = mergeQuery(queries[n], q)
+			} else {
+				queries = append(queries, q)
+			}
+		}
+		conn.Queries = queries
+	}
+	return nil
+}
+
+func queryIndex(queries []Query, name string) int {
+	for i := range queries {
+		if queries[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergeQuery returns base with all fields that are set in o replaced.
+func mergeQuery(base Query, o Query) Query {
+	if len(o.Sql) > 0 {
+		base.Sql = o.Sql
+	}
+	if len(o.Metrics) > 0 {
+		base.Metrics = o.Metrics
+	}
+	if len(o.Labels) > 0 {
+		base.Labels = o.Labels
+	}
+	if len(o.Help) > 0 {
+		base.Help = o.Help
+	}
+	if o.Timeout > 0 {
+		base.Timeout = o.Timeout
+	}
+	if o.Interval > 0 {
+		base.Interval = o.Interval
+	}
+	if len(o.MinVersion) > 0 {
+		base.MinVersion = o.MinVersion
+	}
+	if len(o.MaxVersion) > 0 {
+		base.MaxVersion = o.MaxVersion
+	}
+	if len(o.DatabaseRole) > 0 {
+		base.DatabaseRole = o.DatabaseRole
+	}
+	if len(o.Instances.Include) > 0 || len(o.Instances.Exclude) > 0 {
+		base.Instances = o.Instances
+	}
+	if len(o.Columns) > 0 {
+		base.Columns = o.Columns
+	}
+	if o.PerColumn {
+		base.PerColumn = true
+	}
+	if len(o.Prefix) > 0 {
+		base.Prefix = o.Prefix
+	}
+	if len(o.Duplicates) > 0 {
+		base.Duplicates = o.Duplicates
+	}
+	if len(o.NullValue) > 0 {
+		base.NullValue = o.NullValue
+	}
+	if len(o.Container) > 0 {
+		base.Container = o.Container
+	}
+	if len(o.Requires) > 0 {
+		base.Requires = o.Requires
+	}
+	if len(o.KeyColumn) > 0 {
+		base.KeyColumn = o.KeyColumn
+	}
+	if len(o.ValueColumn) > 0 {
+		base.ValueColumn = o.ValueColumn
+	}
+	if len(o.IncludeKeys) > 0 {
+		base.IncludeKeys = o.IncludeKeys
+	}
+	if len(o.ExcludeKeys) > 0 {
+		base.ExcludeKeys = o.ExcludeKeys
+	}
+	return base
+}
+
 func ReadAccess() {
 	var file = pwd + "/" + *accessFile
 	content, err := ioutil.ReadFile(file)
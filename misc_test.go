@@ -0,0 +1,220 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		bound   string
+		want    int
+	}{
+		{"19.3.0.0.0", "19.3", 0},
+		{"19.3.0.0.0", "19", 0},
+		{"19.3.0.0.0", "19.4", -1},
+		{"19.10.0.0.0", "19.9", 1},
+		{"12.2.0.1.0", "12.2", 0},
+		{"12.1.0.2.0", "12.2", -1},
+		{"18.0.0.0.0", "12.2", 1},
+		{"11.2", "11.2.0.4", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersion(tt.version, tt.bound); got != tt.want {
+			t.Errorf("compareVersion(%q, %q) = %d; want %d", tt.version, tt.bound, got, tt.want)
+		}
+	}
+}
+
+func TestMergeQuery(t *testing.T) {
+	base := Query{
+		Name:       "sessions",
+		Sql:        "SELECT 1 FROM dual",
+		Metrics:    []string{"value"},
+		Labels:     []string{"status"},
+		Timeout:    time.Second,
+		MinVersion: "12.1",
+		Duplicates: "sum",
+	}
+	tests := []struct {
+		name string
+		o    Query
+		want Query
+	}{
+		{"empty keeps base", Query{}, base},
+		{"sql replaced", Query{Sql: "SELECT 2 FROM dual"}, func() Query {
+			q := base
+			q.Sql = "SELECT 2 FROM dual"
+			return q
+		}()},
+		{"lists replaced", Query{Metrics: []string{"a", "b"}, Labels: []string{"c"}}, func() Query {
+			q := base
+			q.Metrics = []string{"a", "b"}
+			q.Labels = []string{"c"}
+			return q
+		}()},
+		{"scalars replaced", Query{Timeout: time.Minute, MaxVersion: "19", NullValue: "nan", PerColumn: true}, func() Query {
+			q := base
+			q.Timeout = time.Minute
+			q.MaxVersion = "19"
+			q.NullValue = "nan"
+			q.PerColumn = true
+			return q
+		}()},
+	}
+	for _, tt := range tests {
+		if got := mergeQuery(base, tt.o); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mergeQuery = %+v; want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveQueries(t *testing.T) {
+	defer func(c Configs) { config = c }(config)
+	sets := map[string][]Query{
+		"base":  {{Name: "sessions", Sql: "SELECT 1 FROM dual", Metrics: []string{"value"}}, {Name: "locks", Sql: "SELECT 2 FROM dual"}},
+		"extra": {{Name: "sessions", Sql: "SELECT 3 FROM dual"}},
+	}
+	tests := []struct {
+		name    string
+		conn    Config
+		queries []string
+		err     string
+	}{
+		{"sets and own queries",
+			Config{Instance: "db1", MetricSets: []string{"base"}, Queries: []Query{{Name: "sessions", Timeout: time.Second}, {Name: "own"}}},
+			[]string{"sessions", "locks", "own"}, ""},
+		{"unknown set",
+			Config{Instance: "db1", MetricSets: []string{"missing"}},
+			nil, "unknown metric set missing"},
+		{"query in two sets",
+			Config{Instance: "db1", MetricSets: []string{"base", "extra"}},
+			nil, "query sessions defined in more than one metric set"},
+	}
+	for _, tt := range tests {
+		config = Configs{MetricSets: sets, Cfgs: []Config{tt.conn}}
+		err := resolveQueries()
+		if len(tt.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v; want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, q := range config.Cfgs[0].Queries {
+			names = append(names, q.Name)
+		}
+		if !reflect.DeepEqual(names, tt.queries) {
+			t.Errorf("%s: queries %v; want %v", tt.name, names, tt.queries)
+		}
+	}
+
+	// The override keeps the fields of the set it doesn't set.
+	config = Configs{MetricSets: sets, Cfgs: []Config{tests[0].conn}}
+	if err := resolveQueries(); err != nil {
+		t.Fatal(err)
+	}
+	q := config.Cfgs[0].Queries
+	if q[0].Sql != "SELECT 1 FROM dual" || q[0].Timeout != time.Second || len(q[0].Metrics) != 1 {
+		t.Errorf("merged query %+v", q[0])
+	}
+}
+
+func TestLoadQueryFiles(t *testing.T) {
+	defer func(c Configs, file string) {
+		config = c
+		*configFile = file
+	}(config, *configFile)
+	dir, err := ioutil.TempDir("", "queries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	*configFile = filepath.Join(dir, "oracle.conf")
+	files := map[string]string{
+		"a.yaml":   "metric_sets:\n  base:\n   - name: sessions\n     sql: SELECT 1 FROM dual\n",
+		"b.yaml":   "metric_sets:\n  extra:\n   - name: locks\n",
+		"dup.yaml": "metric_sets:\n  base:\n   - name: other\n",
+		"bad.yaml": "metric_sets: [",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		files   []string
+		defined map[string][]Query
+		sets    []string
+		err     string
+	}{
+		{"relative and absolute paths", []string{"a.yaml", filepath.Join(dir, "b.yaml")}, nil, []string{"base", "extra"}, ""},
+		{"set in two files", []string{"a.yaml", "dup.yaml"}, nil, nil, "metric set base is already defined"},
+		{"set in file and config", []string{"a.yaml"}, map[string][]Query{"base": nil}, nil, "metric set base is already defined"},
+		{"invalid yaml", []string{"bad.yaml"}, nil, nil, "bad.yaml"},
+		{"missing file", []string{"missing.yaml"}, nil, nil, "missing.yaml"},
+	}
+	for _, tt := range tests {
+		config = Configs{QueryFiles: tt.files, MetricSets: tt.defined}
+		err := loadQueryFiles()
+		if len(tt.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v; want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var sets []string
+		for name := range config.MetricSets {
+			sets = append(sets, name)
+		}
+		sort.Strings(sets)
+		if !reflect.DeepEqual(sets, tt.sets) {
+			t.Errorf("%s: metric sets %v; want %v", tt.name, sets, tt.sets)
+		}
+	}
+}
+
+func TestToFloat(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   interface{}
+		want float64
+		ok   bool
+	}{
+		{float64(1.5), 1.5, true},
+		{float32(2), 2, true},
+		{int64(-3), -3, true},
+		{4, 4, true},
+		{true, 1, true},
+		{false, 0, true},
+		{" 12.5 ", 12.5, true},
+		{[]byte("7"), 7, true},
+		{"abc", 0, false},
+		{ts, float64(ts.Unix()), true},
+		{90 * time.Second, 90, true},
+		{nil, 0, false},
+		{struct{}{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := toFloat(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("toFloat(%#v) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/log"
+)
+
+// Pdbs selects the pluggable databases of a connection, either "all" or a
+// list of PDB names.
+type Pdbs struct {
+	All   bool
+	Names []string
+}
+
+func (p *Pdbs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		if strings.EqualFold(s, "all") {
+			p.All = true
+		} else {
+			p.Names = []string{s}
+		}
+		return nil
+	}
+	return unmarshal(&p.Names)
+}
+
+func (p Pdbs) enabled() bool {
+	return p.All || len(p.Names) > 0
+}
+
+// queryer is implemented by *sql.DB and by *sql.Conn switched to a PDB.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// container is the CDB root or a PDB a collector runs in. It is empty for
+// connections without pdbs.
+type container struct {
+	name  string
+	conID string
+}
+
+// labels returns the pdb and con_id label values if any connection uses pdbs.
+func (c container) labels() []string {
+	if multitenant() {
+		return []string{c.name, c.conID}
+	}
+	return nil
+}
+
+// multitenant reports whether any connection is scraped per PDB.
+func multitenant() bool {
+	for _, conn := range config.Cfgs {
+		if conn.Pdbs.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// pdbLabels returns the label names added to per PDB metrics.
+func pdbLabels() []string {
+	if multitenant() {
+		return []string{"pdb", "con_id"}
+	}
+	return nil
+}
+
+// containers lists the open PDBs of a connection selected by its pdbs setting.
+func containers(conn *Config) ([]container, error) {
+	rows, err := conn.db.Query(`SELECT con_id, name FROM v$containers
+                               WHERE con_id > 2 AND open_mode IN ('READ WRITE','READ ONLY')
+                               ORDER BY con_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pdbs []container
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		if !conn.Pdbs.All {
+			found := false
+			for _, n := range conn.Pdbs.Names {
+				if strings.EqualFold(n, name) {
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		pdbs = append(pdbs, container{name: name, conID: strconv.Itoa(id)})
+	}
+	return pdbs, rows.Err()
+}
+
+// forEachContainer runs fn for a connection. Connections with pdbs run it in
+// the CDB root and then in every PDB listed by Connect on a session switched
+// with ALTER SESSION SET CONTAINER.
+func forEachContainer(conn *Config, fn func(db queryer, pdb container)) {
+	if !conn.Pdbs.enabled() {
+		fn(conn.db, container{})
+		return
+	}
+	fn(conn.db, container{name: "CDB$ROOT", conID: "1"})
+
+	ctx := context.Background()
+	for _, pdb := range conn.pdbs {
+		c, err := conn.db.Conn(ctx)
+		if err != nil {
+			log.Errorln("Error connecting to", conn.Instance+":", err)
+			return
+		}
+		if _, err := c.ExecContext(ctx, `ALTER SESSION SET CONTAINER = "`+pdb.name+`"`); err != nil {
+			log.Errorln("Error switching to PDB", pdb.name, "on", conn.Instance+":", err)
+		} else {
+			fn(c, pdb)
+			// A session left in the PDB must not go back to the pool, the
+			// collectors of the root would run in the PDB.
+			if _, err := c.ExecContext(ctx, `ALTER SESSION SET CONTAINER = CDB$ROOT`); err != nil {
+				log.Errorln("Error switching back from PDB", pdb.name, "on", conn.Instance+":", err)
+				c.Raw(func(interface{}) error { return driver.ErrBadConn })
+			}
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// ScrapeRecovery collects the usage of the fast recovery area per file type
+// and in total and the archivelog generation of the last hour.
+func (e *Exporter) ScrapeRecovery() {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, conn := range config.Cfgs {
+		if conn.ready(stateMounted) {
+			rows, err = conn.db.Query(`SELECT file_type, percent_space_used, percent_space_reclaimable
+                                 FROM v$recovery_area_usage`)
+			if err != nil {
+				// v$recovery_area_usage is called v$flash_recovery_area_usage before 11.2
+				rows, err = conn.db.Query(`SELECT file_type, percent_space_used, percent_space_reclaimable
+                                   FROM v$flash_recovery_area_usage`)
+			}
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var used float64
+					var recl float64
+					if err := rows.Scan(&name, &used, &recl); err != nil {
+						break
+					}
+					name = cleanName(name)
+					e.recoveryUsed.WithLabelValues(conn.Database, conn.Instance, name).Set(used)
+					e.recoveryRecl.WithLabelValues(conn.Database, conn.Instance, name).Set(recl)
+				}
+				rows.Close()
+			}
+
+			rows, err = conn.db.Query(`SELECT name, space_limit, space_used, space_reclaimable
+                                 FROM v$recovery_file_dest`)
+			if err == nil {
+				for rows.Next() {
+					var name sql.NullString
+					var limit, used, recl float64
+					if err := rows.Scan(&name, &limit, &used, &recl); err != nil {
+						break
+					}
+					e.recoveryDest.WithLabelValues(conn.Database, conn.Instance, name.String, "limit").Set(limit)
+					e.recoveryDest.WithLabelValues(conn.Database, conn.Instance, name.String, "used").Set(used)
+					e.recoveryDest.WithLabelValues(conn.Database, conn.Instance, name.String, "reclaimable").Set(recl)
+				}
+				rows.Close()
+			}
+
+			// Every archived log has a row per destination, count each log once.
+			var bytes float64
+			err = conn.db.QueryRow(`SELECT nvl(sum(bytes),0)
+                                FROM (SELECT thread#, sequence#, resetlogs_id, max(blocks*block_size) bytes
+                                      FROM v$archived_log
+                                      WHERE completion_time > sysdate - 1/24
+                                      GROUP BY thread#, sequence#, resetlogs_id)`).Scan(&bytes)
+			if err == nil {
+				e.archivelogBytes.WithLabelValues(conn.Database, conn.Instance).Set(bytes)
+			}
+		}
+	}
+}
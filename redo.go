@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// ScrapeRedo collects log switches, redo generation, the online redo log
+// groups and members and the waits for redo from v$log_history, v$log,
+// v$logfile, v$sysstat and v$system_event.
+func (e *Exporter) ScrapeRedo() {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, conn := range config.Cfgs {
+		if conn.ready(stateMounted) {
+			var value float64
+			err = conn.db.QueryRow(`select count(*) from v$log_history where first_time > sysdate - 1/24/12`).Scan(&value)
+			if err != nil {
+				continue
+			}
+			e.redo.WithLabelValues(conn.Database, conn.Instance).Set(value)
+
+			// The sequence of a thread is increased with every log switch,
+			// unlike v$log_history it is not limited by the controlfile.
+			rows, err = conn.db.Query(`SELECT thread#, group#, status, bytes, sequence# FROM v$log`)
+			if err == nil {
+				sequence := make(map[string]float64)
+				active := make(map[string]float64)
+				for rows.Next() {
+					var thread string
+					var group string
+					var status string
+					var bytes float64
+					var seq float64
+					if err := rows.Scan(&thread, &group, &status, &bytes, &seq); err != nil {
+						break
+					}
+					e.redoLog.WithLabelValues(conn.Database, conn.Instance, thread, group, status).Set(bytes)
+					if seq > sequence[thread] {
+						sequence[thread] = seq
+					}
+					if status == "ACTIVE" {
+						active[thread]++
+					}
+				}
+				rows.Close()
+				for thread, seq := range sequence {
+					e.redoSwitches.Set(seq, conn.Database, conn.Instance, thread)
+					e.redoActive.WithLabelValues(conn.Database, conn.Instance, thread).Set(active[thread])
+				}
+			}
+
+			//status  blank if in use, STALE, INVALID or DELETED
+			rows, err = conn.db.Query(`SELECT group#, member, nvl(status,' ') FROM v$logfile WHERE type = 'ONLINE'`)
+			if err == nil {
+				for rows.Next() {
+					var group string
+					var member string
+					var status string
+					if err := rows.Scan(&group, &member, &status); err != nil {
+						break
+					}
+					value := 0.0
+					if status == " " {
+						status = ""
+						value = 1
+					}
+					e.redoLogfile.WithLabelValues(conn.Database, conn.Instance, group, member, status).Set(value)
+				}
+				rows.Close()
+			}
+
+			var bytes float64
+			err = conn.db.QueryRow(`SELECT value FROM v$sysstat WHERE name = 'redo size'`).Scan(&bytes)
+			if err == nil {
+				e.redoBytes.Set(bytes, conn.Database, conn.Instance)
+			}
+
+			rows, err = conn.db.Query(`SELECT event, total_waits, time_waited_micro/1000000
+                                 FROM v$system_event
+                                 WHERE event IN ('log file sync','log file parallel write',
+                                                 'log file switch (checkpoint incomplete)',
+                                                 'log file switch (archiving needed)',
+                                                 'log file switch completion')`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var waits float64
+					var seconds float64
+					if err := rows.Scan(&name, &waits, &seconds); err != nil {
+						break
+					}
+					name = cleanName(name)
+					e.redoWaits.Set(waits, conn.Database, conn.Instance, name)
+					e.redoWaitTime.Set(seconds, conn.Database, conn.Instance, name)
+				}
+				rows.Close()
+			}
+		}
+	}
+}
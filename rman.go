@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// rmanType maps the input_type of v$rman_backup_job_details and the
+// backup_type of v$backup_set to the type label.
+func rmanType(t string) string {
+	switch t {
+	case "DB FULL", "D":
+		return "full"
+	case "DB INCR", "I":
+		return "incremental"
+	case "ARCHIVELOG", "L":
+		return "archivelog"
+	}
+	return cleanName(t)
+}
+
+// ScrapeRman collects backup metrics from v$rman_backup_job_details and v$backup_set/v$backup_piece.
+func (e *Exporter) ScrapeRman() {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, conn := range config.Cfgs {
+		if conn.ready(stateMounted) {
+			// Age is calculated in the database, end_time is in database server time.
+			rows, err = conn.db.Query(`SELECT input_type, (sysdate - max(end_time))*86400
+                                 FROM v$rman_backup_job_details
+                                 WHERE status IN ('COMPLETED','COMPLETED WITH WARNINGS')
+                                 GROUP BY input_type`)
+			if err != nil {
+				continue
+			}
+			now := float64(time.Now().Unix())
+			for rows.Next() {
+				var name string
+				var age float64
+				if err := rows.Scan(&name, &age); err != nil {
+					break
+				}
+				e.rmanBackup.WithLabelValues(conn.Database, conn.Instance, rmanType(name)).Set(now - age)
+			}
+			rows.Close()
+
+			rows, err = conn.db.Query(`SELECT input_type, status, count(*)
+                                 FROM v$rman_backup_job_details
+                                 WHERE start_time > sysdate - :1/86400
+                                 GROUP BY input_type, status`, rmanWindow.Seconds())
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var status string
+					var value float64
+					if err := rows.Scan(&name, &status, &value); err != nil {
+						break
+					}
+					e.rmanJobs.WithLabelValues(conn.Database, conn.Instance, rmanType(name), status).Set(value)
+				}
+				rows.Close()
+			}
+
+			rows, err = conn.db.Query(`SELECT input_type, status, elapsed_seconds, output_bytes
+                                 FROM (SELECT input_type, status, nvl(elapsed_seconds,0) elapsed_seconds, nvl(output_bytes,0) output_bytes,
+                                              row_number() over (partition by input_type order by start_time desc) rn
+                                       FROM v$rman_backup_job_details)
+                                 WHERE rn = 1`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var status string
+					var elapsed float64
+					var bytes float64
+					if err := rows.Scan(&name, &status, &elapsed, &bytes); err != nil {
+						break
+					}
+					e.rmanDuration.WithLabelValues(conn.Database, conn.Instance, rmanType(name), status).Set(elapsed)
+					e.rmanBytes.WithLabelValues(conn.Database, conn.Instance, rmanType(name), status).Set(bytes)
+				}
+				rows.Close()
+			}
+
+			rows, err = conn.db.Query(`SELECT s.backup_type, sum(p.bytes)
+                                 FROM v$backup_set s, v$backup_piece p
+                                 WHERE s.set_stamp = p.set_stamp AND s.set_count = p.set_count
+                                 AND p.status = 'A'
+                                 GROUP BY s.backup_type`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var bytes float64
+					if err := rows.Scan(&name, &bytes); err != nil {
+						break
+					}
+					e.rmanPieces.WithLabelValues(conn.Database, conn.Instance, rmanType(name)).Set(bytes)
+				}
+				rows.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Segments restricts the segments read by the tablebytes, indexbytes and
+// lobbytes collectors. Without owners all schemas not containing SYS are read.
+type Segments struct {
+	Owners      []string `yaml:"owners"`
+	Tablespaces []string `yaml:"tablespaces"`
+}
+
+// partitionLabels returns the label names added to tablebytes in partition mode.
+func partitionLabels() []string {
+	if *pTabParts {
+		return []string{"partition", "segment_type"}
+	}
+	return nil
+}
+
+// segmentOwner is the owner of the table a segment belongs to, an index can be
+// in another schema than its table.
+const segmentOwner = "coalesce(i.table_owner, s.owner)"
+
+// segmentFilter returns the conditions on dba_segments for the segments config
+// and the conditions on the owner of the table after the joins with their
+// bind values. The owners are applied to dba_segments before the joins, index
+// segments in another schema are read if their table belongs to an owner.
+func segmentFilter() (string, string, []interface{}) {
+	var args []interface{}
+	in := func(column string, names []string) string {
+		binds := make([]string, len(names))
+		for i, n := range names {
+			args = append(args, strings.ToUpper(n))
+			binds[i] = ":" + strconv.Itoa(len(args))
+		}
+		return column + " IN (" + strings.Join(binds, ",") + ")"
+	}
+	where := []string{"s.segment_name NOT LIKE 'BIN$%'"}
+	owner := segmentOwner + " NOT LIKE '%SYS%'"
+	if len(config.Segments.Owners) > 0 {
+		where = append(where, "("+in("s.owner", config.Segments.Owners)+
+			" OR (s.segment_type LIKE 'INDEX%' AND (s.owner, s.segment_name) IN (SELECT owner, index_name FROM dba_indexes WHERE "+
+			in("table_owner", config.Segments.Owners)+")))")
+	} else {
+		where = append(where, "s.owner NOT LIKE '%SYS%'")
+	}
+	if len(config.Segments.Tablespaces) > 0 {
+		where = append(where, in("s.tablespace_name", config.Segments.Tablespaces))
+	}
+	if len(config.Segments.Owners) > 0 {
+		owner = in(segmentOwner, config.Segments.Owners)
+	}
+	return strings.Join(where, " AND "), owner, args
+}
+
+// ScrapeSegments reads dba_segments once and sums the bytes of table, index
+// and LOB segments per table. Index segments are mapped to their table by
+// dba_indexes, LOB segments by dba_lobs. The segments of all partitions and
+// subpartitions are summed up unless tablebytes.partitions is set, which
+// splits the table segments only.
+func (e *Exporter) ScrapeSegments(tables, indexes, lobs bool) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	partition := "NULL"
+	segment := "NULL"
+	if *pTabParts {
+		partition = "CASE WHEN s.segment_type LIKE 'TABLE%' THEN s.partition_name END"
+		segment = "CASE WHEN s.segment_type LIKE 'TABLE%' THEN s.segment_type END"
+	}
+	var types []string
+	if tables {
+		types = append(types, "s.segment_type LIKE 'TABLE%'")
+	}
+	if indexes {
+		types = append(types, "s.segment_type LIKE 'INDEX%'")
+	}
+	if lobs {
+		types = append(types, "s.segment_type LIKE 'LOB%'")
+	}
+	filter, owner, args := segmentFilter()
+	for _, conn := range config.Cfgs {
+		if conn.ready(stateOpen) {
+			rows, err = conn.db.Query(`SELECT owner, table_name, kind, partition_name, segment_type, sum(bytes)
+                                 FROM (SELECT `+segmentOwner+` owner, coalesce(i.table_name, l.table_name, s.segment_name) table_name,
+                                              CASE WHEN s.segment_type LIKE 'TABLE%' THEN 'TABLE'
+                                                   WHEN s.segment_type LIKE 'LOB%' AND s.segment_type != 'LOBINDEX' THEN 'LOB'
+                                                   WHEN i.index_type = 'LOB' THEN 'LOB'
+                                                   ELSE 'INDEX' END kind,
+                                              `+partition+` partition_name, `+segment+` segment_type, s.bytes
+                                       FROM (SELECT s.owner, s.segment_name, s.segment_type, s.partition_name, s.bytes
+                                             FROM dba_segments s
+                                             WHERE (`+strings.Join(types, " OR ")+`)
+                                             AND `+filter+`) s
+                                       LEFT JOIN dba_indexes i ON i.owner = s.owner AND i.index_name = s.segment_name
+                                                               AND (s.segment_type LIKE 'INDEX%' OR s.segment_type = 'LOBINDEX')
+                                       LEFT JOIN dba_lobs l ON l.owner = s.owner AND l.segment_name = s.segment_name
+                                                            AND s.segment_type IN ('LOBSEGMENT','LOB PARTITION','LOB SUBPARTITION')
+                                       WHERE `+owner+`)
+                                 GROUP BY owner, table_name, kind, partition_name, segment_type`, args...)
+			if err != nil {
+				continue
+			}
+			for rows.Next() {
+				var owner string
+				var name string
+				var kind string
+				var partition sql.NullString
+				var segment sql.NullString
+				var value float64
+				if err := rows.Scan(&owner, &name, &kind, &partition, &segment, &value); err != nil {
+					break
+				}
+				name = cleanName(name)
+				switch kind {
+				case "TABLE":
+					labels := []string{conn.Database, conn.Instance, owner, name}
+					if *pTabParts {
+						labels = append(labels, partition.String, cleanName(segment.String))
+					}
+					e.tablebytes.WithLabelValues(labels...).Set(value)
+				case "INDEX":
+					e.indexbytes.WithLabelValues(conn.Database, conn.Instance, owner, name).Set(value)
+				case "LOB":
+					e.lobbytes.WithLabelValues(conn.Database, conn.Instance, owner, name).Set(value)
+				}
+			}
+			rows.Close()
+		}
+	}
+}
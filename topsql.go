@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// TopSql restricts the statements considered by the top SQL collector.
+type TopSql struct {
+	SqlIds  []string `yaml:"sql_ids"`
+	Schemas []string `yaml:"schemas"`
+}
+
+// sqlStat holds the cumulative statistics of one statement from v$sqlstats.
+type sqlStat struct {
+	text     string
+	schema   string
+	values   [4]float64
+	lastSeen time.Time
+}
+
+// Statistics of sqlStat.values, ranked separately by their delta.
+const (
+	sqlElapsed = iota
+	sqlCpu
+	sqlGets
+	sqlExecs
+)
+
+// ScrapeTopsql collects the statements with the highest elapsed time, CPU
+// time, buffer gets and executions since the last scrape from v$sqlstats.
+func (e *Exporter) ScrapeTopsql() {
+	withSchema := *pTopsqlSchema || len(config.TopSql.Schemas) > 0
+	for _, conn := range config.Cfgs {
+		if !conn.ready(stateOpen) {
+			continue
+		}
+		key := conn.Database + "/" + conn.Instance
+		prev := e.sqlStats[key]
+		since := 5 * time.Minute
+		if last, ok := e.sqlScraped[key]; ok {
+			since = time.Since(last) + time.Minute
+		}
+
+		schema := "NULL"
+		from := "v$sqlstats s"
+		if withSchema {
+			schema = "a.parsing_schema_name"
+			from = `v$sqlstats s, (SELECT sql_id, max(parsing_schema_name) parsing_schema_name
+                                       FROM v$sqlarea GROUP BY sql_id) a
+                                 WHERE s.sql_id = a.sql_id AND`
+		} else {
+			from += " WHERE"
+		}
+		rows, err := conn.db.Query(`SELECT s.sql_id, max(substr(s.sql_text,1,200)), max(`+schema+`),
+                                 sum(s.elapsed_time)/1000000, sum(s.cpu_time)/1000000, sum(s.buffer_gets), sum(s.executions)
+                                 FROM `+from+` s.last_active_time > sysdate - :1/86400
+                                 GROUP BY s.sql_id`, since.Seconds())
+		if err != nil {
+			log.Errorln("Error reading v$sqlstats of", conn.Instance+":", err)
+			continue
+		}
+		e.sqlScraped[key] = time.Now()
+
+		cur := make(map[string]*sqlStat)
+		for rows.Next() {
+			var id string
+			var s sqlStat
+			var owner sql.NullString
+			if err := rows.Scan(&id, &s.text, &owner, &s.values[sqlElapsed], &s.values[sqlCpu],
+				&s.values[sqlGets], &s.values[sqlExecs]); err != nil {
+				break
+			}
+			s.schema = owner.String
+			if !topsqlAllowed(id, s.schema) {
+				continue
+			}
+			s.lastSeen = time.Now()
+			cur[id] = &s
+		}
+		rows.Close()
+
+		// Rank by the change since the last scrape, statements seen the
+		// first time by their total.
+		selected := make(map[string]bool)
+		for stat := sqlElapsed; stat <= sqlExecs; stat++ {
+			ids := make([]string, 0, len(cur))
+			delta := make(map[string]float64)
+			for id, s := range cur {
+				ids = append(ids, id)
+				delta[id] = s.values[stat]
+				if p, ok := prev[id]; ok {
+					delta[id] -= p.values[stat]
+				}
+			}
+			sort.Slice(ids, func(i, j int) bool { return delta[ids[i]] > delta[ids[j]] })
+			for i := 0; i < len(ids) && i < *pTopsqlTop; i++ {
+				if delta[ids[i]] > 0 {
+					selected[ids[i]] = true
+				}
+			}
+		}
+
+		for id := range selected {
+			s := cur[id]
+			text := ""
+			if *pTopsqlText > 0 {
+				text = strings.Join(strings.Fields(s.text), " ")
+				if len(text) > *pTopsqlText {
+					text = text[:*pTopsqlText]
+				}
+				text = strings.ToValidUTF8(text, "")
+			}
+			labels := []string{conn.Database, conn.Instance, id, text, s.schema}
+			e.sqlElapsed.Set(s.values[sqlElapsed], labels...)
+			e.sqlCpu.Set(s.values[sqlCpu], labels...)
+			e.sqlGets.Set(s.values[sqlGets], labels...)
+			e.sqlExecs.Set(s.values[sqlExecs], labels...)
+		}
+
+		// Keep statements that were not active for an hour to rank them by
+		// their delta when they show up again.
+		if prev == nil {
+			prev = make(map[string]*sqlStat)
+			e.sqlStats[key] = prev
+		}
+		for id, s := range prev {
+			if time.Since(s.lastSeen) > time.Hour {
+				delete(prev, id)
+			}
+		}
+		for id, s := range cur {
+			prev[id] = s
+		}
+	}
+}
+
+// topsqlAllowed checks a statement against the topsql allowlist of the config.
+func topsqlAllowed(id string, schema string) bool {
+	if len(config.TopSql.SqlIds) == 0 && len(config.TopSql.Schemas) == 0 {
+		return true
+	}
+	for _, s := range config.TopSql.SqlIds {
+		if s == id {
+			return true
+		}
+	}
+	for _, s := range config.TopSql.Schemas {
+		if strings.EqualFold(s, schema) {
+			return true
+		}
+	}
+	return false
+}
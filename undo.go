@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// ScrapeUndo collects undo usage per status from dba_undo_extents, the tuned
+// retention and undo errors from v$undostat and temp usage from v$tempseg_usage.
+func (e *Exporter) ScrapeUndo() {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, conn := range config.Cfgs {
+		if conn.ready(stateOpen) {
+			rows, err = conn.db.Query(`SELECT tablespace_name, status, sum(bytes)
+                                 FROM dba_undo_extents
+                                 GROUP BY tablespace_name, status`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var status string
+					var bytes float64
+					if err := rows.Scan(&name, &status, &bytes); err != nil {
+						break
+					}
+					e.undoBytes.WithLabelValues(conn.Database, conn.Instance, name, strings.ToLower(status)).Set(bytes)
+				}
+				rows.Close()
+			}
+
+			// v$undostat has one row per 10 minutes, the newest for the running interval.
+			var retention, maxquery float64
+			err = conn.db.QueryRow(`SELECT tuned_undoretention, maxquerylen
+                                FROM (SELECT tuned_undoretention, maxquerylen FROM v$undostat ORDER BY end_time DESC)
+                                WHERE rownum = 1`).Scan(&retention, &maxquery)
+			if err == nil {
+				e.undoRetention.WithLabelValues(conn.Database, conn.Instance).Set(retention)
+				e.undoMaxQuery.WithLabelValues(conn.Database, conn.Instance).Set(maxquery)
+			}
+
+			var snapshot, nospace float64
+			err = conn.db.QueryRow(`SELECT nvl(sum(ssolderrcnt),0), nvl(sum(nospaceerrcnt),0)
+                                FROM v$undostat
+                                WHERE end_time > sysdate - 1/24`).Scan(&snapshot, &nospace)
+			if err == nil {
+				e.undoErrors.WithLabelValues(conn.Database, conn.Instance, "snapshot_too_old").Set(snapshot)
+				e.undoErrors.WithLabelValues(conn.Database, conn.Instance, "no_space").Set(nospace)
+			}
+
+			rows, err = conn.db.Query(`SELECT u.tablespace, sum(u.blocks*t.block_size)
+                                 FROM v$tempseg_usage u, dba_tablespaces t
+                                 WHERE u.tablespace = t.tablespace_name
+                                 GROUP BY u.tablespace`)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var bytes float64
+					if err := rows.Scan(&name, &bytes); err != nil {
+						break
+					}
+					e.tempUsed.WithLabelValues(conn.Database, conn.Instance, name).Set(bytes)
+				}
+				rows.Close()
+			}
+
+			rows, err = conn.db.Query(`SELECT tablespace, username, sql_id, bytes
+                                 FROM (SELECT u.tablespace, u.username, u.sql_id, sum(u.blocks*t.block_size) bytes
+                                       FROM v$tempseg_usage u, dba_tablespaces t
+                                       WHERE u.tablespace = t.tablespace_name
+                                       GROUP BY u.tablespace, u.username, u.sql_id
+                                       ORDER BY sum(u.blocks*t.block_size) DESC)
+                                 WHERE rownum <= :1`, *pUndoTop)
+			if err == nil {
+				for rows.Next() {
+					var name string
+					var user sql.NullString
+					var sqlid sql.NullString
+					var bytes float64
+					if err := rows.Scan(&name, &user, &sqlid, &bytes); err != nil {
+						break
+					}
+					e.tempSession.WithLabelValues(conn.Database, conn.Instance, name, user.String, sqlid.String).Set(bytes)
+				}
+				rows.Close()
+			}
+		}
+	}
+}
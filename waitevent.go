@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// ScrapeWaitevents collects the top wait events by time waited from the v$system_event view.
+func (e *Exporter) ScrapeWaitevents() {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, conn := range config.Cfgs {
+		if conn.db != nil {
+			rows, err = conn.db.Query(`SELECT event, wait_class, total_waits, time_waited_micro/1000000
+                                 FROM (SELECT event, wait_class, total_waits, time_waited_micro
+                                       FROM v$system_event
+                                       WHERE wait_class != 'Idle'
+                                       ORDER BY time_waited_micro DESC)
+                                 WHERE rownum <= :1`, *pWaiteventsTop)
+			if err != nil {
+				continue
+			}
+			for rows.Next() {
+				var name string
+				var class string
+				var waits float64
+				var seconds float64
+				if err := rows.Scan(&name, &class, &waits, &seconds); err != nil {
+					break
+				}
+				name = cleanName(name)
+				class = cleanName(class)
+				e.waitevents.Set(waits, conn.Database, conn.Instance, name, class)
+				e.waiteventTime.Set(seconds, conn.Database, conn.Instance, name, class)
+			}
+			rows.Close()
+		}
+	}
+}
+
+// ScrapeAsh collects the average number of active sessions per wait class,
+// event and sql_id from v$active_session_history (Diagnostics Pack).
+func (e *Exporter) ScrapeAsh() {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, conn := range config.Cfgs {
+		if conn.db != nil {
+			rows, err = conn.db.Query(`SELECT wait_class, event, sql_id, samples
+                                 FROM (SELECT decode(session_state,'ON CPU','CPU',wait_class) wait_class,
+                                              decode(session_state,'ON CPU','ON CPU',event) event,
+                                              sql_id, count(*) samples
+                                       FROM v$active_session_history
+                                       WHERE sample_time > systimestamp - numtodsinterval(:1,'SECOND')
+                                       GROUP BY decode(session_state,'ON CPU','CPU',wait_class),
+                                                decode(session_state,'ON CPU','ON CPU',event), sql_id
+                                       ORDER BY count(*) DESC)
+                                 WHERE rownum <= :2`, pAshInterval.Seconds(), *pWaiteventsTop)
+			if err != nil {
+				continue
+			}
+			for rows.Next() {
+				var class string
+				var name string
+				var sqlid sql.NullString
+				var samples float64
+				if err := rows.Scan(&class, &name, &sqlid, &samples); err != nil {
+					break
+				}
+				e.ash.WithLabelValues(conn.Database, conn.Instance, cleanName(class), cleanName(name), sqlid.String).Set(samples / pAshInterval.Seconds())
+			}
+			rows.Close()
+		}
+	}
+}